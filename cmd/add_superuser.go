@@ -51,14 +51,16 @@ func addSuperuser(email string, name string, password string) error {
 		return nil
 	}
 
-	salt, _ := utils.GenerateSalt()
-	hashedPassword := utils.HashPassword(password, salt)
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
 
 	insertQuery := `
-		INSERT INTO users (id, email, first_name, password_hash, salt, is_admin, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		INSERT INTO users (id, email, first_name, password_hash, is_admin, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), NOW())
 	`
-	_, err = db.Exec(insertQuery, utils.GenerateID("usr"), email, name, hashedPassword, salt, true)
+	_, err = db.Exec(insertQuery, utils.GenerateID("usr"), email, name, hashedPassword, true)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/santoshkpatro/unbit/internal/config"
+	"github.com/santoshkpatro/unbit/internal/worker"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deadLetterLimit int64
+	replayAll       bool
+)
+
+var deadLetterListCmd = &cobra.Command{
+	Use:   "dead_letter_list",
+	Short: "List events that exhausted their retries",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return deadLetterList(deadLetterLimit)
+	},
+}
+
+var deadLetterReplayCmd = &cobra.Command{
+	Use:   "dead_letter_replay [id...]",
+	Short: "Move dead-lettered events back onto the event queue",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !replayAll {
+			return fmt.Errorf("pass one or more dead letter ids, or --all")
+		}
+		return deadLetterReplay(args)
+	},
+}
+
+func init() {
+	deadLetterListCmd.Flags().Int64VarP(&deadLetterLimit, "limit", "l", 50, "Maximum number of dead letters to show")
+	deadLetterReplayCmd.Flags().BoolVar(&replayAll, "all", false, "Replay every dead letter")
+}
+
+func deadLetterList(limit int64) error {
+	ctx := context.Background()
+
+	cache, err := config.NewRedisConnection(ctx)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	letters, err := worker.ListDeadLetters(ctx, cache, limit)
+	if err != nil {
+		return err
+	}
+	if len(letters) == 0 {
+		fmt.Println("✅ No dead letters")
+		return nil
+	}
+
+	for _, l := range letters {
+		fmt.Printf("%s  failed_at=%s attempts=%d\n", l.ID, l.FailedAt, l.Attempts)
+		fmt.Printf("    error:   %s\n", l.Error)
+		fmt.Printf("    payload: %s\n", l.Payload)
+	}
+	return nil
+}
+
+func deadLetterReplay(ids []string) error {
+	ctx := context.Background()
+
+	cache, err := config.NewRedisConnection(ctx)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+
+	replayed, err := worker.ReplayDeadLetters(ctx, cache, ids)
+	if err != nil {
+		return fmt.Errorf("replayed %d before failing: %w", replayed, err)
+	}
+
+	fmt.Printf("✅ Replayed %d event(s)\n", replayed)
+	return nil
+}
@@ -20,4 +20,6 @@ func init() {
 	rootCmd.AddCommand(dbMigrateCmd)
 	rootCmd.AddCommand(addSuperuserCmd)
 	rootCmd.AddCommand(startWorkerCmd)
+	rootCmd.AddCommand(deadLetterListCmd)
+	rootCmd.AddCommand(deadLetterReplayCmd)
 }
@@ -20,15 +20,26 @@ type CustomValidator struct {
 	validator *validator.Validate
 }
 
+var embeddedWorker bool
+
 var startServerCmd = &cobra.Command{
 	Use:   "start_server",
 	Short: "Start Server",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return startServer()
+		return startServer(embeddedWorker, worker.Options{
+			Concurrency: workerConcurrency,
+			BatchSize:   workerBatchSize,
+		})
 	},
 }
 
-func startServer() error {
+func init() {
+	startServerCmd.Flags().BoolVar(&embeddedWorker, "worker", true, "Also run an event worker in this process (disable when running start_worker separately)")
+	startServerCmd.Flags().IntVarP(&workerConcurrency, "concurrency", "c", 4, "Maximum number of batches the embedded worker processes at once")
+	startServerCmd.Flags().IntVarP(&workerBatchSize, "batch-size", "b", 100, "Maximum number of events the embedded worker writes per transaction (at most 1000)")
+}
+
+func startServer(withWorker bool, workerOpts worker.Options) error {
 	e := echo.New()
 
 	// e.Use(middleware.Logger())
@@ -38,6 +49,12 @@ func startServer() error {
 	// Set up custom validator for Request validation
 	e.Validator = &CustomValidator{validator: validator.New()}
 
+	ipExtractor, err := config.NewIPExtractor()
+	if err != nil {
+		log.Fatalf("❌ failed to set up client addresses: %v", err)
+	}
+	e.IPExtractor = ipExtractor
+
 	ctx := context.Background()
 
 	db, err := config.NewPostgresConnection(ctx)
@@ -52,7 +69,12 @@ func startServer() error {
 	}
 	defer cache.Close()
 
-	config.RegisterRoutes(e, db, cache)
+	mail, err := config.NewMailer()
+	if err != nil {
+		log.Fatalf("❌ failed to set up mailer: %v", err)
+	}
+
+	config.RegisterRoutes(e, db, cache, mail)
 
 	// Start server
 	go func() {
@@ -62,10 +84,18 @@ func startServer() error {
 	}()
 
 	// Start Worker
-	go func() {
-		queueName := "issues"
-		worker.StartWorker(cache, db, queueName)
-	}()
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	workerDone := make(chan struct{})
+	if withWorker {
+		go func() {
+			defer close(workerDone)
+			if err := worker.StartWorker(workerCtx, cache, db, workerOpts); err != nil {
+				log.Printf("worker stopped: %v", err)
+			}
+		}()
+	} else {
+		close(workerDone)
+	}
 
 	// Wait for Ctrl+C or SIGTERM
 	quit := make(chan os.Signal, 1)
@@ -81,6 +111,13 @@ func startServer() error {
 		log.Fatalf("❌ Server forced to shutdown: %v", err)
 	}
 
+	stopWorker()
+	select {
+	case <-workerDone:
+	case <-ctxShutdown.Done():
+		log.Println("⚠️  Worker did not drain in time")
+	}
+
 	log.Println("✅ Server exited properly")
 
 	return nil
@@ -2,97 +2,79 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
 	"github.com/santoshkpatro/unbit/internal/config"
+	"github.com/santoshkpatro/unbit/internal/worker"
 	"github.com/spf13/cobra"
 )
 
+var (
+	workerConcurrency  int
+	workerBatchSize    int
+	workerDrainTimeout time.Duration
+)
+
 var startWorkerCmd = &cobra.Command{
 	Use:   "start_worker",
 	Short: "Start Worker",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return startWorker()
+		return startWorker(worker.Options{
+			Concurrency: workerConcurrency,
+			BatchSize:   workerBatchSize,
+		}, workerDrainTimeout)
 	},
 }
 
-func startWorker() error {
-	const (
-		queueName      = "unbit_jobs"
-		maxConcurrency = 5
-	)
+func init() {
+	startWorkerCmd.Flags().IntVarP(&workerConcurrency, "concurrency", "c", 4, "Maximum number of batches processed at once")
+	startWorkerCmd.Flags().IntVarP(&workerBatchSize, "batch-size", "b", 100, "Maximum number of events written per transaction (at most 1000)")
+	startWorkerCmd.Flags().DurationVar(&workerDrainTimeout, "drain-timeout", 30*time.Second, "How long to wait for in-flight events on shutdown")
+}
+
+func startWorker(opts worker.Options, drainTimeout time.Duration) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	cacheClient, _ := config.NewRedisConnection(ctx)
-	if err := cacheClient.Ping(ctx).Err(); err != nil {
-		return fmt.Errorf("redis ping failed: %w", err)
+	db, err := config.NewPostgresConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres: %w", err)
 	}
-	fmt.Println("Connected to Redis, waiting for jobs...")
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-sigCh
-		fmt.Println("Shutting down worker...")
-		cancel()
-	}()
-
-	sem := make(chan struct{}, maxConcurrency)
-	var wg sync.WaitGroup
+	defer db.Close()
 
-	for {
-		select {
-		case <-ctx.Done():
-			wg.Wait()
-			fmt.Println("All jobs complete. Exiting.")
-			return nil
-		default:
-			// Blocking pop (waits until a job appears)
-			res, err := cacheClient.BLPop(ctx, 0*time.Second, queueName).Result()
-			if err != nil {
-				if ctx.Err() != nil {
-					return nil // Context cancelled, exit
-				}
-				fmt.Println("Error reading from Redis:", err)
-				continue
-			}
+	cache, err := config.NewRedisConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	defer cache.Close()
 
-			if len(res) < 2 {
-				continue
-			}
-			payload := res[1]
+	done := make(chan error, 1)
+	go func() {
+		done <- worker.StartWorker(ctx, cache, db, opts)
+	}()
 
-			// Limit concurrency
-			sem <- struct{}{}
-			wg.Add(1)
-			go func(p string) {
-				defer wg.Done()
-				defer func() { <-sem }()
-				if err := processJob(p); err != nil {
-					fmt.Println("Job failed:", err)
-				} else {
-					fmt.Println("Job done!")
-				}
-			}(payload)
-		}
-	}
-}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-func processJob(payload string) error {
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(payload), &data); err != nil {
-		return fmt.Errorf("invalid JSON: %w", err)
+	select {
+	case err := <-done:
+		return err
+	case <-sigCh:
 	}
 
-	fmt.Printf("Processing job: %+v\n", data)
+	log.Println("⚙️  Shutting down worker, draining in-flight events...")
+	cancel()
 
-	// Simulate work
-	time.Sleep(2 * time.Second)
-	return nil
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(drainTimeout):
+		// Unacknowledged events stay pending and are claimed by another worker.
+		return fmt.Errorf("drain timed out after %s", drainTimeout)
+	}
 }
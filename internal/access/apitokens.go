@@ -0,0 +1,87 @@
+package access
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+// APITokenPrefix starts every project API token, so leaked ones are easy to
+// spot.
+const APITokenPrefix = "unbit_"
+
+// tokenPermissions is what a project API token may do in its project. Tokens
+// are meant for CI, recording releases, deploys and their artifacts.
+var tokenPermissions = []Permission{ViewProject, ManageReleases}
+
+// NewAPIToken returns a random project API token and the hash stored for
+// it. The token itself is only shown once.
+func NewAPIToken() (token string, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashAPIToken(token)
+}
+
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequireUserOrToken is RequireUser for routes CI calls as well, which
+// authenticate with "Authorization: Bearer <project API token>". Token
+// requests act as the user who created the token, limited to its project
+// and tokenPermissions.
+func RequireUserOrToken(db *sqlx.DB) echo.MiddlewareFunc {
+	requireUser := RequireUser(db)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withUser := requireUser(next)
+		return func(c echo.Context) error {
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok {
+				return withUser(c)
+			}
+
+			var principal Principal
+			err := db.GetContext(c.Request().Context(), &principal, `
+				UPDATE project_api_tokens t
+				SET last_used_at = NOW()
+				FROM users u
+				WHERE t.token_hash = $1 AND u.id = t.created_by AND u.is_active
+				RETURNING u.id, u.email, t.project_id AS token_project_id
+			`, HashAPIToken(strings.TrimSpace(token)))
+			if errors.Is(err, sql.ErrNoRows) {
+				return utils.RespondFail(c, http.StatusUnauthorized, "Invalid API token", nil)
+			}
+			if err != nil {
+				return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+			}
+
+			c.Set(principalKey, principal)
+			return next(c)
+		}
+	}
+}
+
+// tokenAllows checks a token principal against the project it belongs to.
+// Other projects don't exist as far as the token is concerned.
+func (p Principal) tokenAllows(projectID string, perm Permission) error {
+	if projectID != p.TokenProjectID {
+		return ErrNotFound
+	}
+	for _, allowed := range tokenPermissions {
+		if allowed == perm {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
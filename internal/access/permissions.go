@@ -0,0 +1,175 @@
+package access
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+// Role is a user's role in a project, from project_members.role.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleViewer Role = "viewer"
+)
+
+// Permission is something a role allows doing in a project.
+type Permission string
+
+const (
+	ViewProject    Permission = "project:view"
+	ManageProject  Permission = "project:manage"
+	ManageReleases Permission = "releases:manage"
+	ManageMembers  Permission = "members:manage"
+	ResolveIssues  Permission = "issues:resolve"
+	AssignIssues   Permission = "issues:assign"
+	MergeIssues    Permission = "issues:merge"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner:  {ViewProject, ManageProject, ManageReleases, ManageMembers, ResolveIssues, AssignIssues, MergeIssues},
+	RoleAdmin:  {ViewProject, ManageProject, ManageReleases, ManageMembers, ResolveIssues, AssignIssues, MergeIssues},
+	RoleMember: {ViewProject, ResolveIssues, AssignIssues, MergeIssues},
+	RoleViewer: {ViewProject},
+}
+
+// Can reports whether the role allows perm.
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// CanGrant reports whether the role may give other users role, such as by
+// inviting them. Only owners make owners.
+func (r Role) CanGrant(role Role) bool {
+	if !r.Can(ManageMembers) || !role.Valid() {
+		return false
+	}
+	return role != RoleOwner || r == RoleOwner
+}
+
+var (
+	// ErrNotFound is returned for projects the user can't see at all, so
+	// their existence isn't given away.
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is returned when the user's role doesn't allow the action.
+	ErrForbidden = errors.New("permission denied")
+)
+
+// VisibleProjects returns a subquery of the IDs of the projects a user can
+// see, with the user's ID bound to placeholder. Admins see every project.
+func VisibleProjects(placeholder string) string {
+	return "SELECT project_id FROM project_members WHERE user_id = " + placeholder +
+		" UNION ALL SELECT id FROM projects WHERE EXISTS (SELECT 1 FROM users WHERE id = " + placeholder + " AND is_admin)"
+}
+
+// ProjectRole returns the user's role in a project. Admins act as owners of
+// every project. Users who aren't members get ErrNotFound.
+func (p Principal) ProjectRole(db sqlx.Queryer, projectID string) (Role, error) {
+	var role sql.NullString
+	err := sqlx.Get(db, &role, `
+		SELECT pm.role
+		FROM projects pr
+		LEFT JOIN project_members pm ON pm.project_id = pr.id AND pm.user_id = $2
+		WHERE pr.id = $1
+	`, projectID, p.ID)
+	return p.role(role, err)
+}
+
+// IssueRole returns the project of an issue and the user's role in it, like
+// ProjectRole.
+func (p Principal) IssueRole(db sqlx.Queryer, issueID string) (string, Role, error) {
+	var row struct {
+		ProjectID string         `db:"project_id"`
+		Role      sql.NullString `db:"role"`
+	}
+	err := sqlx.Get(db, &row, `
+		SELECT i.project_id, pm.role
+		FROM issues i
+		LEFT JOIN project_members pm ON pm.project_id = i.project_id AND pm.user_id = $2
+		WHERE i.id = $1
+	`, issueID, p.ID)
+	role, err := p.role(row.Role, err)
+	return row.ProjectID, role, err
+}
+
+func (p Principal) role(role sql.NullString, err error) (Role, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if p.IsAdmin {
+		return RoleOwner, nil
+	}
+	if !role.Valid {
+		return "", ErrNotFound
+	}
+	return Role(role.String), nil
+}
+
+// AuthorizeProject checks that the current user, or project API token, may
+// perm in a project.
+func AuthorizeProject(c echo.Context, db sqlx.Queryer, projectID string, perm Permission) error {
+	principal := CurrentUser(c)
+	if principal.TokenProjectID != "" {
+		return principal.tokenAllows(projectID, perm)
+	}
+	role, err := principal.ProjectRole(db, projectID)
+	if err != nil {
+		return err
+	}
+	if !role.Can(perm) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeIssue checks that the current user may perm in the project of an
+// issue, which it returns.
+func AuthorizeIssue(c echo.Context, db sqlx.Queryer, issueID string, perm Permission) (string, error) {
+	principal := CurrentUser(c)
+	if principal.TokenProjectID != "" {
+		// Tokens are for releases, issues are out of their reach
+		return "", ErrNotFound
+	}
+	projectID, role, err := principal.IssueRole(db, issueID)
+	if err != nil {
+		return "", err
+	}
+	if !role.Can(perm) {
+		return "", ErrForbidden
+	}
+	return projectID, nil
+}
+
+// RespondDenied responds to a failed authorization, with notFound as the
+// message when the user can't see the resource.
+func RespondDenied(c echo.Context, err error, notFound string) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return utils.RespondFail(c, http.StatusNotFound, notFound, nil)
+	case errors.Is(err, ErrForbidden):
+		return utils.RespondFail(c, http.StatusForbidden, "Permission denied", nil)
+	default:
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+}
@@ -0,0 +1,66 @@
+// Package access authenticates API requests and decides what the
+// authenticated user may do in each project.
+package access
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+const principalKey = "principal"
+
+// Principal is the user a request is made by. Requests made with a project
+// API token carry the token's project, see RequireUserOrToken.
+type Principal struct {
+	ID             string `db:"id"`
+	Email          string `db:"email"`
+	IsAdmin        bool   `db:"is_admin"`
+	TokenProjectID string `db:"token_project_id"`
+}
+
+// RequireUser loads the user of the session onto the context and rejects
+// requests without one. Users deactivated since they logged in are rejected
+// too.
+func RequireUser(db *sqlx.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			sess, err := session.Get("session", c)
+			if err != nil {
+				return utils.RespondFail(c, http.StatusInternalServerError, "Session error", err.Error())
+			}
+			userID, ok := sess.Values["loggedInUser"].(string)
+			if !ok || userID == "" {
+				return utils.RespondFail(c, http.StatusUnauthorized, "User not authenticated", nil)
+			}
+
+			var principal Principal
+			err = db.GetContext(c.Request().Context(), &principal, `
+				SELECT id, email, is_admin
+				FROM users
+				WHERE id = $1 AND is_active
+			`, userID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return utils.RespondFail(c, http.StatusUnauthorized, "User not authenticated", nil)
+			}
+			if err != nil {
+				return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+			}
+
+			c.Set(principalKey, principal)
+			return next(c)
+		}
+	}
+}
+
+// CurrentUser returns the user RequireUser authenticated. Handlers outside
+// of it get the zero Principal, which can't see any project.
+func CurrentUser(c echo.Context) Principal {
+	principal, _ := c.Get(principalKey).(Principal)
+	return principal
+}
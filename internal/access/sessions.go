@@ -0,0 +1,380 @@
+package access
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+const (
+	sessionPrefix      = "session:"
+	userSessionsPrefix = "user_sessions:"
+
+	defaultSessionTimeout = 30 * time.Minute
+	// timeoutCacheTTL is how long the idle timeout setting is reused before
+	// reading it again.
+	timeoutCacheTTL = time.Minute
+	maxUserAgentLen = 512
+)
+
+// SessionStore keeps sessions in Redis, with only a signed session ID in the
+// cookie, so they can be listed and revoked. Sessions expire after
+// security.sessionTimeoutMinutes without a request, and once their cookie's
+// MaxAge has passed since login.
+type SessionStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+	// ExtractIP reads the client address recorded with a session, the
+	// connection address if nil. Set it to the server's echo.IPExtractor.
+	ExtractIP echo.IPExtractor
+
+	cache *redis.Client
+	db    *sqlx.DB
+
+	mu          sync.Mutex
+	timeout     time.Duration
+	timeoutRead time.Time
+}
+
+// NewSessionStore returns a store signing session IDs with keyPairs, like
+// sessions.NewCookieStore.
+func NewSessionStore(cache *redis.Client, db *sqlx.DB, keyPairs ...[]byte) *SessionStore {
+	return &SessionStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   86400 * 7,
+			HttpOnly: true,
+		},
+		cache: cache,
+		db:    db,
+	}
+}
+
+// SessionInfo describes a session of a user.
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	UserAgent string    `json:"userAgent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Current   bool      `json:"current"`
+
+	key string
+}
+
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of the request's cookie, or returns a new one if
+// there is none or it has expired or been revoked. Loading a session counts
+// as activity and pushes its idle timeout back.
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var key string
+	// Unreadable cookies, such as ones signed with an older secret, just
+	// start a new session
+	if err := securecookie.DecodeMulti(name, cookie.Value, &key, s.Codecs...); err != nil {
+		return session, nil
+	}
+
+	ctx := r.Context()
+	data, err := s.cache.HGetAll(ctx, sessionPrefix+key).Result()
+	if err != nil {
+		return session, err
+	}
+	if len(data) == 0 {
+		return session, nil
+	}
+
+	timeout := s.idleTimeout(ctx)
+	info := parseSessionInfo(key, data)
+	now := time.Now()
+	if now.Sub(info.LastSeen) > timeout || (opts.MaxAge > 0 && now.Sub(info.CreatedAt) > time.Duration(opts.MaxAge)*time.Second) {
+		s.cache.Del(ctx, sessionPrefix+key)
+		return session, nil
+	}
+
+	if err := (securecookie.GobEncoder{}).Deserialize([]byte(data["values"]), &session.Values); err != nil {
+		return session, nil
+	}
+	session.ID = key
+	session.IsNew = false
+
+	pipe := s.cache.Pipeline()
+	pipe.HSet(ctx, sessionPrefix+key, "last_seen", now.Unix(), "ip", s.clientIP(r))
+	pipe.Expire(ctx, sessionPrefix+key, timeout)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️  failed to touch session: %v", err)
+	}
+	return session, nil
+}
+
+// Save stores the session and sets its cookie. A negative MaxAge deletes it.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx := r.Context()
+
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.cache.Del(ctx, sessionPrefix+session.ID).Err(); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = newSessionKey()
+	}
+	values, err := securecookie.GobEncoder{}.Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+	userID, _ := session.Values["loggedInUser"].(string)
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLen {
+		userAgent = userAgent[:maxUserAgentLen]
+	}
+
+	key := sessionPrefix + session.ID
+	now := time.Now().Unix()
+	pipe := s.cache.TxPipeline()
+	pipe.HSetNX(ctx, key, "id", utils.GenerateID("ses"))
+	pipe.HSetNX(ctx, key, "created_at", now)
+	pipe.HSet(ctx, key,
+		"values", values,
+		"user_id", userID,
+		"ip", s.clientIP(r),
+		"user_agent", userAgent,
+		"last_seen", now,
+	)
+	pipe.Expire(ctx, key, s.idleTimeout(ctx))
+	if userID != "" {
+		pipe.SAdd(ctx, userSessionsPrefix+userID, session.ID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// idleTimeout reads the security.sessionTimeoutMinutes setting, reusing it
+// for timeoutCacheTTL.
+func (s *SessionStore) idleTimeout(ctx context.Context) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timeout > 0 && time.Since(s.timeoutRead) < timeoutCacheTTL {
+		return s.timeout
+	}
+
+	var minutes int
+	if err := utils.GetSetting(s.db, "security.sessionTimeoutMinutes", &minutes); err != nil || minutes < 1 {
+		s.timeout = defaultSessionTimeout
+	} else {
+		s.timeout = time.Duration(minutes) * time.Minute
+	}
+	s.timeoutRead = time.Now()
+	return s.timeout
+}
+
+// UserSessions lists the live sessions of a user, most recently active
+// first, marking the one with key current. Expired sessions are dropped
+// from the user's index on the way.
+func UserSessions(ctx context.Context, cache *redis.Client, userID string, current string) ([]SessionInfo, error) {
+	keys, err := cache.SMembers(ctx, userSessionsPrefix+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := cache.Pipeline()
+	results := make([]*redis.MapStringStringCmd, len(keys))
+	for i, key := range keys {
+		results[i] = pipe.HGetAll(ctx, sessionPrefix+key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	infos := []SessionInfo{}
+	var stale []interface{}
+	for i, key := range keys {
+		data := results[i].Val()
+		// Sessions of another user or logged out ones are dropped too
+		if len(data) == 0 || data["user_id"] != userID {
+			stale = append(stale, key)
+			continue
+		}
+		info := parseSessionInfo(key, data)
+		info.Current = key == current
+		infos = append(infos, info)
+	}
+	if len(stale) > 0 {
+		cache.SRem(ctx, userSessionsPrefix+userID, stale...)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].LastSeen.After(infos[j].LastSeen)
+	})
+	return infos, nil
+}
+
+// RevokeSession ends the session of a user with the public id sessionID. It
+// reports whether there was one.
+func RevokeSession(ctx context.Context, cache *redis.Client, userID string, sessionID string) (bool, error) {
+	infos, err := UserSessions(ctx, cache, userID, "")
+	if err != nil {
+		return false, err
+	}
+	for _, info := range infos {
+		if info.ID == sessionID {
+			return true, revoke(ctx, cache, userID, info.key)
+		}
+	}
+	return false, nil
+}
+
+// RevokeUserSessions ends every session of a user but the one with key
+// except, which may be empty, and returns how many were ended.
+func RevokeUserSessions(ctx context.Context, cache *redis.Client, userID string, except string) (int, error) {
+	keys, err := cache.SMembers(ctx, userSessionsPrefix+userID).Result()
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, key := range keys {
+		if key == except {
+			continue
+		}
+		if err := revoke(ctx, cache, userID, key); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// DeleteSession removes a loaded session from Redis and from its user's
+// index, leaving its cookie to be replaced. New sessions are left alone.
+func DeleteSession(ctx context.Context, cache *redis.Client, session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	userID, _ := session.Values["loggedInUser"].(string)
+	return revoke(ctx, cache, userID, session.ID)
+}
+
+func revoke(ctx context.Context, cache *redis.Client, userID string, key string) error {
+	pipe := cache.TxPipeline()
+	pipe.Del(ctx, sessionPrefix+key)
+	pipe.SRem(ctx, userSessionsPrefix+userID, key)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func parseSessionInfo(key string, data map[string]string) SessionInfo {
+	createdAt, _ := strconv.ParseInt(data["created_at"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(data["last_seen"], 10, 64)
+	return SessionInfo{
+		ID:        data["id"],
+		Device:    describeDevice(data["user_agent"]),
+		UserAgent: data["user_agent"],
+		IP:        data["ip"],
+		CreatedAt: time.Unix(createdAt, 0).UTC(),
+		LastSeen:  time.Unix(lastSeen, 0).UTC(),
+		key:       key,
+	}
+}
+
+func newSessionKey() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(b), "=")
+}
+
+// clientIP is the address a request came from. Forwarding headers are only
+// believed through ExtractIP, any client can set them.
+func (s *SessionStore) clientIP(r *http.Request) string {
+	if s.ExtractIP != nil {
+		return s.ExtractIP(r)
+	}
+	return echo.ExtractIPDirect()(r)
+}
+
+// describeDevice names the browser and operating system of a user agent,
+// such as "Chrome on macOS".
+func describeDevice(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser, system := "", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,57 @@
+package access
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// Tokens signs the values carried by links sent in emails, such as
+// invitations, so they can't be forged or used past their lifetime.
+type Tokens struct {
+	secret []byte
+}
+
+func NewTokens(secret []byte) *Tokens {
+	return &Tokens{secret: secret}
+}
+
+// codec derives a key per purpose, so a token made for one flow is never
+// accepted by another or as a session cookie.
+func (t *Tokens) codec(purpose string, ttl time.Duration) *securecookie.SecureCookie {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte("token:" + purpose))
+
+	codec := securecookie.New(mac.Sum(nil), nil)
+	codec.MaxAge(int(ttl.Seconds()))
+	codec.SetSerializer(securecookie.JSONEncoder{})
+	return codec
+}
+
+// Sign returns a URL safe token carrying value for ttl.
+func (t *Tokens) Sign(purpose string, value interface{}, ttl time.Duration) (string, error) {
+	return t.codec(purpose, ttl).Encode(purpose, value)
+}
+
+// Verify decodes a token made by Sign for purpose into dst, failing if it
+// was tampered with or is older than ttl.
+func (t *Tokens) Verify(purpose string, token string, ttl time.Duration, dst interface{}) error {
+	return t.codec(purpose, ttl).Decode(purpose, token, dst)
+}
+
+// Token purposes with their lifetimes.
+const (
+	VerifyEmailToken = "verify_email"
+	VerifyEmailTTL   = 48 * time.Hour
+
+	InviteToken = "invite"
+	InviteTTL   = 7 * 24 * time.Hour
+)
+
+// InviteClaims is carried by invitation tokens, signed when a project
+// invites someone and read back when they accept.
+type InviteClaims struct {
+	InviteID string `json:"inviteId"`
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/santoshkpatro/unbit/internal/access"
+	"github.com/santoshkpatro/unbit/internal/mailer"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+const (
+	defaultPasswordMinLength = 8
+
+	// verificationResendInterval is how long to wait before sending an
+	// address another verification email.
+	verificationResendInterval = time.Minute
+	verificationSentPrefix     = "verification_sent:"
+
+	// Password reset links are single use and short lived, only a hash of
+	// their token is stored
+	passwordResetTTL        = time.Hour
+	passwordResetInterval   = time.Minute
+	passwordResetSentPrefix = "password_reset_sent:"
+
+	// An address may ask for a few resets an hour across all emails
+	passwordResetIPLimit  = 10
+	passwordResetIPWindow = time.Hour
+	passwordResetIPPrefix = "password_reset_ip:"
+)
+
+// normalizeEmail lowercases emails of new accounts and invitations so the
+// same address can't sign up twice in different cases.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkPassword enforces the auth.passwordMinLength setting on new passwords.
+func (v *AuthContext) checkPassword(password string) error {
+	minLength := defaultPasswordMinLength
+	if err := utils.GetSetting(v.DB, "auth.passwordMinLength", &minLength); err != nil || minLength < 1 {
+		minLength = defaultPasswordMinLength
+	}
+	if utf8.RuneCountInString(password) < minLength {
+		return fmt.Errorf("password must be at least %d characters", minLength)
+	}
+	return nil
+}
+
+// createUser adds an account, returning sql.ErrNoRows if the email is taken.
+func createUser(db sqlx.Queryer, email, firstName string, lastName *string, password string, verified bool) (User, error) {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	var user User
+	err = sqlx.Get(db, &user, `
+		INSERT INTO users (id, email, first_name, last_name, password_hash, email_verified_at)
+		SELECT $1, $2, $3, $4, $5, CASE WHEN $6 THEN NOW() END
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE lower(email) = lower($2))
+		ON CONFLICT (email) DO NOTHING
+		RETURNING *
+	`, utils.GenerateID("usr"), email, firstName, lastName, hash, verified)
+	return user, err
+}
+
+// sendVerification emails a user a link to confirm their address.
+func (v *AuthContext) sendVerification(ctx context.Context, user User) error {
+	token, err := v.Tokens.Sign(access.VerifyEmailToken, verifyEmailClaims{UserID: user.ID, Email: user.Email}, access.VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	link := utils.SiteLink(v.DB, "/verify-email", url.Values{"token": {token}})
+	return v.Mailer.Send(ctx, mailer.VerifyEmailMessage(user.Email, utils.SiteName(v.DB), link))
+}
+
+// setPassword replaces a user's password, upgrading its hash on the way.
+func setPassword(db sqlx.Execer, userID string, password string) error {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE users SET password_hash = $2, salt = NULL, updated_at = NOW() WHERE id = $1
+	`, userID, hash)
+	return err
+}
+
+// newResetToken returns a random password reset token and the hash stored
+// for it.
+func newResetToken() (token string, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashResetToken(token)
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendPasswordReset emails a reset link to the active account of email, if
+// there is one. It runs after the request has been answered so the answer
+// doesn't tell whether the account exists, and only logs what goes wrong.
+func (v *AuthContext) sendPasswordReset(ctx context.Context, email string) {
+	var user User
+	err := v.DB.GetContext(ctx, &user, "SELECT * FROM users WHERE lower(email) = $1 AND is_active", email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  password reset: failed to load user: %v", err)
+		return
+	}
+
+	tx, err := v.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("⚠️  password reset: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Only the latest link works
+	if _, err := tx.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1`, user.ID); err != nil {
+		log.Printf("⚠️  password reset: failed to delete old tokens: %v", err)
+		return
+	}
+	token, hash := newResetToken()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, utils.GenerateID("prt"), user.ID, hash, time.Now().Add(passwordResetTTL))
+	if err != nil {
+		log.Printf("⚠️  password reset: failed to store token: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("⚠️  password reset: failed to store token: %v", err)
+		return
+	}
+
+	link := utils.SiteLink(v.DB, "/reset-password", url.Values{"token": {token}})
+	if err := v.Mailer.Send(ctx, mailer.PasswordResetMessage(user.Email, utils.SiteName(v.DB), link)); err != nil {
+		log.Printf("⚠️  password reset: failed to send email to user %s: %v", user.ID, err)
+	}
+}
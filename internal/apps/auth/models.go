@@ -8,14 +8,70 @@ type loginData struct {
 }
 
 type User struct {
-	ID           string    `db:"id" json:"id"`
-	Email        string    `db:"email" json:"email"`
-	FirstName    string    `db:"first_name" json:"firstName"`
-	LastName     *string   `db:"last_name" json:"lastName"`
-	IsAdmin      bool      `db:"is_admin" json:"isAdmin"`
-	IsActive     bool      `db:"is_active" json:"-"`
-	PasswordHash string    `db:"password_hash" json:"-"`
-	Salt         string    `db:"salt" json:"-"`
-	CreatedAt    time.Time `db:"created_at" json:"-"`
-	UpdatedAt    time.Time `db:"updated_at" json:"-"`
+	ID              string     `db:"id" json:"id"`
+	Email           string     `db:"email" json:"email"`
+	FirstName       string     `db:"first_name" json:"firstName"`
+	LastName        *string    `db:"last_name" json:"lastName"`
+	IsAdmin         bool       `db:"is_admin" json:"isAdmin"`
+	IsActive        bool       `db:"is_active" json:"-"`
+	PasswordHash    string     `db:"password_hash" json:"-"`
+	Salt            *string    `db:"salt" json:"-"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"emailVerifiedAt"`
+	CreatedAt       time.Time  `db:"created_at" json:"-"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"-"`
+}
+
+type registerData struct {
+	Email     string  `json:"email" validate:"required,email,max=254"`
+	FirstName string  `json:"firstName" validate:"required,max=100"`
+	LastName  *string `json:"lastName" validate:"omitempty,max=100"`
+	Password  string  `json:"password" validate:"required,max=1024"`
+}
+
+type verifyEmailData struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type resendVerificationData struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type inviteAcceptData struct {
+	Token string `json:"token" validate:"required"`
+	// Only needed when the invited email has no account yet
+	FirstName string  `json:"firstName" validate:"max=100"`
+	LastName  *string `json:"lastName" validate:"omitempty,max=100"`
+	Password  string  `json:"password" validate:"max=1024"`
+}
+
+// verifyEmailClaims is carried by email verification tokens.
+type verifyEmailClaims struct {
+	UserID string `json:"userId"`
+	Email  string `json:"email"`
+}
+
+// Invite is a pending invitation as shown to the person invited.
+type Invite struct {
+	ID          string    `db:"id" json:"id"`
+	Email       string    `db:"email" json:"email"`
+	Role        string    `db:"role" json:"role"`
+	ProjectID   string    `db:"project_id" json:"projectId"`
+	ProjectName string    `db:"project_name" json:"projectName"`
+	InvitedBy   *string   `db:"invited_by_name" json:"invitedBy"`
+	ExpiresAt   time.Time `db:"expires_at" json:"expiresAt"`
+	UserExists  bool      `db:"user_exists" json:"userExists"`
+}
+
+type passwordChangeData struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,max=1024"`
+}
+
+type passwordForgotData struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type passwordResetData struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,max=1024"`
 }
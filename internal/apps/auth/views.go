@@ -1,17 +1,24 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
+	"github.com/santoshkpatro/unbit/internal/access"
 	"github.com/santoshkpatro/unbit/internal/utils"
 )
 
+// dummyPasswordHash is compared against when the email is unknown.
+var dummyPasswordHash, _ = utils.HashPassword("unbit")
+
 func (v *AuthContext) LoginUser(c echo.Context) error {
 	var data loginData
 	if err := c.Bind(&data); err != nil {
@@ -22,20 +29,55 @@ func (v *AuthContext) LoginUser(c echo.Context) error {
 		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
 	}
 
-	var userExists bool
-	query := "SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)"
-	err := v.DB.Get(&userExists, query, data.Email)
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	if lockout := v.loginLockout(ctx, data.Email, ip); lockout > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(lockout.Seconds())+1))
+		return utils.RespondFail(c, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+	}
+
+	var user User
+	err := v.DB.Get(&user, "SELECT * FROM users WHERE lower(email) = lower($1)", data.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Hash anyway so unknown emails take as long as wrong passwords
+		utils.ComparePassword(data.Password, "", dummyPasswordHash)
+		v.recordLoginFailure(ctx, data.Email, ip)
+		return utils.RespondFail(c, http.StatusUnauthorized, "Invalid email or password", nil)
+	}
 	if err != nil {
 		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
 	}
-	if !userExists {
+
+	var salt string
+	if user.Salt != nil {
+		salt = *user.Salt
+	}
+	if !utils.ComparePassword(data.Password, salt, user.PasswordHash) {
+		v.recordLoginFailure(ctx, data.Email, ip)
 		return utils.RespondFail(c, http.StatusUnauthorized, "Invalid email or password", nil)
 	}
+	v.clearLoginFailures(ctx, data.Email)
 
-	var user User
-	err = v.DB.Get(&user, "SELECT * FROM users WHERE email = $1", data.Email)
-	if err != nil {
-		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	if !user.IsActive {
+		return utils.RespondFail(c, http.StatusForbidden, "Account is disabled", nil)
+	}
+	if user.EmailVerifiedAt == nil && utils.SettingEnabled(v.DB, "auth.requireEmailVerification", true) {
+		return utils.RespondFail(c, http.StatusForbidden, "Email address not verified", nil)
+	}
+
+	// Upgrade hashes from older schemes now that the password is known
+	if utils.PasswordNeedsRehash(user.PasswordHash) {
+		hash, err := utils.HashPassword(data.Password)
+		if err != nil {
+			return utils.RespondFail(c, http.StatusInternalServerError, "Failed to hash password", err.Error())
+		}
+		_, err = v.DB.Exec(`
+			UPDATE users SET password_hash = $1, salt = NULL, updated_at = NOW()
+			WHERE id = $2 AND password_hash = $3
+		`, hash, user.ID, user.PasswordHash)
+		if err != nil {
+			return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+		}
 	}
 
 	sess, err := session.Get("session", c)
@@ -47,6 +89,12 @@ func (v *AuthContext) LoginUser(c echo.Context) error {
 		MaxAge:   86400 * 7,
 		HttpOnly: true,
 	}
+	// A fresh session on login keeps a session planted before it from being
+	// logged in
+	if err := access.DeleteSession(c.Request().Context(), v.Cache, sess); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Session error", err.Error())
+	}
+	sess.ID = ""
 	sess.Values["loggedInUser"] = user.ID
 	if err := sess.Save(c.Request(), c.Response()); err != nil {
 		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to save session", err.Error())
@@ -56,7 +104,7 @@ func (v *AuthContext) LoginUser(c echo.Context) error {
 }
 
 func (v *AuthContext) Profile(c echo.Context) error {
-	userID, _ := utils.CheckAuthentication(c)
+	userID := access.CurrentUser(c).ID
 	var user User
 	err := v.DB.Get(&user, "SELECT * FROM users WHERE id = $1", userID)
 	if err != nil {
@@ -83,9 +131,8 @@ func (v *AuthContext) AuthStatus(c echo.Context) error {
 	id := fmt.Sprint(userID)
 
 	var user User
-	if err := v.DB.Get(&user, "SELECT * FROM users WHERE id = $1", id); err != nil {
+	if err := v.DB.Get(&user, "SELECT * FROM users WHERE id = $1 AND is_active", id); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			sess.Values["loggedInUser"] = nil
 			return utils.RespondOK(c, map[string]interface{}{
 				"isLoggedIn":  false,
 				"userProfile": nil,
@@ -100,3 +147,475 @@ func (v *AuthContext) AuthStatus(c echo.Context) error {
 		"userProfile": user,
 	}, "")
 }
+
+// LogoutUser ends the current session.
+func (v *AuthContext) LogoutUser(c echo.Context) error {
+	sess, err := session.Get("session", c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Session error", err.Error())
+	}
+	sess.Options.MaxAge = -1
+	if err := sess.Save(c.Request(), c.Response()); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to end session", err.Error())
+	}
+
+	return utils.RespondOK(c, nil, "Logout successful")
+}
+
+// SessionListView lists the user's active sessions, such as on other
+// devices, with the current one marked.
+func (v *AuthContext) SessionListView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	sess, err := session.Get("session", c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Session error", err.Error())
+	}
+
+	sessions, err := access.UserSessions(c.Request().Context(), v.Cache, userID, sess.ID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch sessions", err.Error())
+	}
+
+	return utils.RespondOK(c, sessions, "")
+}
+
+// SessionRevokeView ends one of the user's sessions, such as on a lost
+// device.
+func (v *AuthContext) SessionRevokeView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+
+	found, err := access.RevokeSession(c.Request().Context(), v.Cache, userID, c.Param("session_id"))
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to revoke session", err.Error())
+	}
+	if !found {
+		return utils.RespondFail(c, http.StatusNotFound, "Session not found", nil)
+	}
+
+	return utils.RespondOK(c, nil, "Session revoked")
+}
+
+// SessionRevokeAllView ends all of the user's sessions but the current one.
+func (v *AuthContext) SessionRevokeAllView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	sess, err := session.Get("session", c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Session error", err.Error())
+	}
+
+	revoked, err := access.RevokeUserSessions(c.Request().Context(), v.Cache, userID, sess.ID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to revoke sessions", err.Error())
+	}
+
+	return utils.RespondOK(c, map[string]interface{}{"revoked": revoked}, "Other sessions revoked")
+}
+
+// RegisterUser signs up a new user when auth.allowRegistration is on. With
+// auth.requireEmailVerification the user can log in once they have followed
+// the link emailed to them.
+func (v *AuthContext) RegisterUser(c echo.Context) error {
+	if !utils.SettingEnabled(v.DB, "auth.allowRegistration", false) {
+		return utils.RespondFail(c, http.StatusForbidden, "Registration is disabled", nil)
+	}
+
+	var data registerData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request data", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+	if err := v.checkPassword(data.Password); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	requireVerification := utils.SettingEnabled(v.DB, "auth.requireEmailVerification", true)
+	user, err := createUser(v.DB, normalizeEmail(data.Email), data.FirstName, data.LastName, data.Password, !requireVerification)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusConflict, "Email is already registered", nil)
+	}
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create account", err.Error())
+	}
+
+	if !requireVerification {
+		return utils.RespondOK(c, user, "Account created")
+	}
+	if err := v.sendVerification(c.Request().Context(), user); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Account created but the verification email could not be sent", err.Error())
+	}
+
+	return utils.RespondOK(c, user, "Account created, check your email to verify it")
+}
+
+// VerifyEmail confirms a user's address from the token emailed to them.
+func (v *AuthContext) VerifyEmail(c echo.Context) error {
+	var data verifyEmailData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request data", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	var claims verifyEmailClaims
+	if err := v.Tokens.Verify(access.VerifyEmailToken, data.Token, access.VerifyEmailTTL, &claims); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid or expired link", nil)
+	}
+
+	// The email must still match, so a token can't verify an address the
+	// account has since moved away from
+	result, err := v.DB.Exec(`
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1 AND email = $2
+	`, claims.UserID, claims.Email)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid or expired link", nil)
+	}
+
+	return utils.RespondOK(c, nil, "Email verified")
+}
+
+// ResendVerification sends another verification email. It answers the same
+// whether or not the address has an unverified account, so it can't be used
+// to find out which addresses are registered.
+func (v *AuthContext) ResendVerification(c echo.Context) error {
+	var data resendVerificationData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request data", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+	const message = "If the account needs verifying, an email is on its way"
+
+	ctx := c.Request().Context()
+	email := normalizeEmail(data.Email)
+	sent, err := v.Cache.SetNX(ctx, verificationSentPrefix+email, 1, verificationResendInterval).Result()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Cache error", err.Error())
+	}
+	if !sent {
+		return utils.RespondOK(c, nil, message)
+	}
+
+	var user User
+	err = v.DB.Get(&user, `
+		SELECT * FROM users WHERE lower(email) = $1 AND email_verified_at IS NULL AND is_active
+	`, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondOK(c, nil, message)
+	}
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	if err := v.sendVerification(ctx, user); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to send email", err.Error())
+	}
+
+	return utils.RespondOK(c, nil, message)
+}
+
+// loadInvite reads the pending invitation a token refers to.
+func (v *AuthContext) loadInvite(q sqlx.Queryer, token string, lock bool) (Invite, error) {
+	var claims access.InviteClaims
+	if err := v.Tokens.Verify(access.InviteToken, token, access.InviteTTL, &claims); err != nil {
+		return Invite{}, sql.ErrNoRows
+	}
+
+	query := `
+		SELECT
+			pi.id,
+			pi.email,
+			pi.role,
+			pi.project_id,
+			p.name AS project_name,
+			NULLIF(concat_ws(' ', u.first_name, u.last_name), '') AS invited_by_name,
+			pi.expires_at,
+			EXISTS (SELECT 1 FROM users WHERE lower(email) = lower(pi.email)) AS user_exists
+		FROM
+			project_invites pi
+			JOIN projects p ON p.id = pi.project_id
+			LEFT JOIN users u ON u.id = pi.invited_by
+		WHERE
+			pi.id = $1
+			AND pi.accepted_at IS NULL
+			AND pi.expires_at > NOW()
+	`
+	if lock {
+		query += " FOR UPDATE OF pi"
+	}
+	var invite Invite
+	err := sqlx.Get(q, &invite, query, claims.InviteID)
+	return invite, err
+}
+
+// InviteDetailView shows an invitation to the person invited, telling them
+// whether to log in or create an account to accept it.
+func (v *AuthContext) InviteDetailView(c echo.Context) error {
+	invite, err := v.loadInvite(v.DB, c.Param("token"), false)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusNotFound, "Invitation not found or expired", nil)
+	}
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	return utils.RespondOK(c, invite, "")
+}
+
+// AcceptInvite adds the invited user to the project. Someone new to the app
+// creates their account with it, its email counting as verified; existing
+// users must be logged in as the invited address.
+func (v *AuthContext) AcceptInvite(c echo.Context) error {
+	var data inviteAcceptData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request data", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	defer tx.Rollback()
+
+	invite, err := v.loadInvite(tx, data.Token, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusNotFound, "Invitation not found or expired", nil)
+	}
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	var user User
+	if invite.UserExists {
+		sess, err := session.Get("session", c)
+		if err != nil {
+			return utils.RespondFail(c, http.StatusInternalServerError, "Session error", err.Error())
+		}
+		userID, _ := sess.Values["loggedInUser"].(string)
+		err = tx.Get(&user, `
+			SELECT * FROM users WHERE id = $1 AND lower(email) = lower($2) AND is_active
+		`, userID, invite.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.RespondFail(c, http.StatusUnauthorized, "Log in as "+invite.Email+" to accept this invitation", nil)
+		}
+		if err != nil {
+			return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+		}
+	} else {
+		if data.FirstName == "" {
+			return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", "firstName is required")
+		}
+		if err := v.checkPassword(data.Password); err != nil {
+			return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+		}
+		// Receiving the invitation proves the address
+		user, err = createUser(tx, invite.Email, data.FirstName, data.LastName, data.Password, true)
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.RespondFail(c, http.StatusConflict, "Email is already registered", nil)
+		}
+		if err != nil {
+			return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create account", err.Error())
+		}
+	}
+
+	// Members keep the role they have
+	_, err = tx.Exec(`
+		INSERT INTO project_members (id, project_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (project_id, user_id) DO NOTHING
+	`, utils.GenerateID("prm"), invite.ProjectID, user.ID, invite.Role)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to join project", err.Error())
+	}
+	_, err = tx.Exec(`
+		UPDATE project_invites SET accepted_by = $2, accepted_at = NOW() WHERE id = $1
+	`, invite.ID, user.ID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to accept invitation", err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to accept invitation", err.Error())
+	}
+
+	return utils.RespondOK(c, map[string]interface{}{
+		"projectId": invite.ProjectID,
+		"user":      user,
+	}, "Invitation accepted")
+}
+
+// ChangePassword sets a new password for the logged in user after checking
+// their current one, and ends their other sessions. Wrong current passwords
+// count as failed logins.
+func (v *AuthContext) ChangePassword(c echo.Context) error {
+	principal := access.CurrentUser(c)
+	var data passwordChangeData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request data", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	ctx := c.Request().Context()
+	ip := c.RealIP()
+	if lockout := v.loginLockout(ctx, principal.Email, ip); lockout > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(lockout.Seconds())+1))
+		return utils.RespondFail(c, http.StatusTooManyRequests, "Too many failed attempts, try again later", nil)
+	}
+
+	var user User
+	if err := v.DB.Get(&user, "SELECT * FROM users WHERE id = $1", principal.ID); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	var salt string
+	if user.Salt != nil {
+		salt = *user.Salt
+	}
+	if !utils.ComparePassword(data.CurrentPassword, salt, user.PasswordHash) {
+		v.recordLoginFailure(ctx, principal.Email, ip)
+		return utils.RespondFail(c, http.StatusBadRequest, "Current password is incorrect", nil)
+	}
+	v.clearLoginFailures(ctx, principal.Email)
+
+	if err := v.checkPassword(data.NewPassword); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := setPassword(tx, user.ID, data.NewPassword); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to change password", err.Error())
+	}
+
+	// Like a reset, the other sessions end before the change commits
+	sess, err := session.Get("session", c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Session error", err.Error())
+	}
+	if _, err := access.RevokeUserSessions(ctx, v.Cache, user.ID, sess.ID); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to revoke sessions", err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to change password", err.Error())
+	}
+
+	return utils.RespondOK(c, nil, "Password changed")
+}
+
+// ForgotPassword emails a password reset link. It answers the same whether
+// or not the address has an account, the link is sent in the background.
+func (v *AuthContext) ForgotPassword(c echo.Context) error {
+	var data passwordForgotData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request data", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+	const message = "If the email has an account, a reset link is on its way"
+
+	ctx := c.Request().Context()
+	ipKey := passwordResetIPPrefix + c.RealIP()
+	pipe := v.Cache.TxPipeline()
+	requests := pipe.Incr(ctx, ipKey)
+	pipe.ExpireNX(ctx, ipKey, passwordResetIPWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Cache error", err.Error())
+	}
+	if requests.Val() > passwordResetIPLimit {
+		return utils.RespondFail(c, http.StatusTooManyRequests, "Too many reset requests, try again later", nil)
+	}
+
+	email := normalizeEmail(data.Email)
+	sent, err := v.Cache.SetNX(ctx, passwordResetSentPrefix+email, 1, passwordResetInterval).Result()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Cache error", err.Error())
+	}
+	if sent {
+		go v.sendPasswordReset(context.WithoutCancel(ctx), email)
+	}
+
+	return utils.RespondOK(c, nil, message)
+}
+
+// ResetPassword sets a new password from a reset link and ends all other
+// sessions of the user. The link also proves the address.
+func (v *AuthContext) ResetPassword(c echo.Context) error {
+	var data passwordResetData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request data", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+	if err := v.checkPassword(data.Password); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	defer tx.Rollback()
+
+	var user User
+	err = tx.Get(&user, `
+		UPDATE password_reset_tokens t
+		SET used_at = NOW()
+		FROM users u
+		WHERE t.user_id = u.id
+			AND t.token_hash = $1
+			AND t.used_at IS NULL
+			AND t.expires_at > NOW()
+			AND u.is_active
+		RETURNING u.*
+	`, hashResetToken(data.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid or expired link", nil)
+	}
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	if err := setPassword(tx, user.ID, data.Password); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to reset password", err.Error())
+	}
+	if _, err := tx.Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1
+	`, user.ID); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to reset password", err.Error())
+	}
+
+	// Sessions are ended before the new password commits, so a reset never
+	// succeeds while they live on
+	ctx := c.Request().Context()
+	sess, err := session.Get("session", c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Session error", err.Error())
+	}
+	if _, err := access.RevokeUserSessions(ctx, v.Cache, user.ID, sess.ID); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to revoke sessions", err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to reset password", err.Error())
+	}
+
+	// The account was locked out if the password was being guessed
+	v.clearLoginFailures(ctx, user.Email)
+
+	return utils.RespondOK(c, nil, "Password reset, you can now log in")
+}
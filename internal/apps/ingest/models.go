@@ -0,0 +1,102 @@
+package ingest
+
+import "encoding/json"
+
+type envelopeHeader struct {
+	EventID string `json:"event_id"`
+	DSN     string `json:"dsn"`
+}
+
+type envelopeItemHeader struct {
+	Type   string `json:"type"`
+	Length *int   `json:"length"`
+}
+
+type sentryLogEntry struct {
+	Message   string `json:"message"`
+	Formatted string `json:"formatted"`
+}
+
+type sentryFrame struct {
+	Function    string                     `json:"function"`
+	Module      string                     `json:"module"`
+	Filename    string                     `json:"filename"`
+	AbsPath     string                     `json:"abs_path"`
+	Lineno      int                        `json:"lineno"`
+	Colno       int                        `json:"colno"`
+	ContextLine string                     `json:"context_line"`
+	InApp       *bool                      `json:"in_app"`
+	PreContext  []string                   `json:"pre_context"`
+	PostContext []string                   `json:"post_context"`
+	Vars        map[string]json.RawMessage `json:"vars"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryMechanism struct {
+	Type        string `json:"type"`
+	Handled     *bool  `json:"handled"`
+	Description string `json:"description"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Module     string            `json:"module"`
+	Mechanism  *sentryMechanism  `json:"mechanism"`
+	Stacktrace *sentryStacktrace `json:"stacktrace"`
+}
+
+type sentryThread struct {
+	ID         json.RawMessage   `json:"id"`
+	Name       string            `json:"name"`
+	Crashed    bool              `json:"crashed"`
+	Current    bool              `json:"current"`
+	Stacktrace *sentryStacktrace `json:"stacktrace"`
+}
+
+type sentryBreadcrumb struct {
+	Timestamp json.RawMessage `json:"timestamp"`
+	Type      string          `json:"type"`
+	Category  string          `json:"category"`
+	Level     string          `json:"level"`
+	Message   string          `json:"message"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type sentryUser struct {
+	ID        json.RawMessage `json:"id"`
+	Email     string          `json:"email"`
+	IPAddress string          `json:"ip_address"`
+	Username  string          `json:"username"`
+}
+
+type sentryRequest struct {
+	URL     string          `json:"url"`
+	Method  string          `json:"method"`
+	Headers json.RawMessage `json:"headers"`
+}
+
+type sentryEvent struct {
+	EventID     string                     `json:"event_id"`
+	Timestamp   json.RawMessage            `json:"timestamp"`
+	Level       string                     `json:"level"`
+	Platform    string                     `json:"platform"`
+	Logger      string                     `json:"logger"`
+	ServerName  string                     `json:"server_name"`
+	Message     json.RawMessage            `json:"message"`
+	LogEntry    *sentryLogEntry            `json:"logentry"`
+	Exception   json.RawMessage            `json:"exception"`
+	Threads     json.RawMessage            `json:"threads"`
+	Contexts    map[string]json.RawMessage `json:"contexts"`
+	Extra       map[string]json.RawMessage `json:"extra"`
+	Fingerprint []string                   `json:"fingerprint"`
+	Release     string                     `json:"release"`
+	Environment string                     `json:"environment"`
+	Breadcrumbs json.RawMessage            `json:"breadcrumbs"`
+	Tags        json.RawMessage            `json:"tags"`
+	User        *sentryUser                `json:"user"`
+	Request     *sentryRequest             `json:"request"`
+}
@@ -0,0 +1,555 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/santoshkpatro/unbit/internal/models"
+)
+
+// maxSentryBodySize caps the decompressed size of a store or envelope request.
+const maxSentryBodySize = 20 << 20
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// readSentryBody returns the request body, decoded according to Content-Encoding.
+func readSentryBody(r *http.Request) ([]byte, error) {
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxSentryBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		reader = bytes.NewReader(raw)
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		// Most SDKs send zlib-wrapped deflate, a few send the raw stream.
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			reader = flate.NewReader(bytes.NewReader(raw))
+		} else {
+			defer zr.Close()
+			reader = zr
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", r.Header.Get("Content-Encoding"))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, maxSentryBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	if len(body) > maxSentryBodySize {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
+
+// sentryPublicKey extracts the DSN public key from the X-Sentry-Auth header,
+// the Authorization header or the sentry_key query parameter.
+func sentryPublicKey(r *http.Request) string {
+	for _, header := range []string{"X-Sentry-Auth", "Authorization"} {
+		value := strings.TrimSpace(r.Header.Get(header))
+		if !strings.HasPrefix(strings.ToLower(value), "sentry ") {
+			continue
+		}
+		for _, part := range strings.Split(value[len("sentry "):], ",") {
+			key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if ok && strings.TrimSpace(key) == "sentry_key" {
+				return strings.TrimSpace(val)
+			}
+		}
+	}
+
+	return r.URL.Query().Get("sentry_key")
+}
+
+// publicKeyFromDSN returns the public key part of a DSN such as
+// https://<key>@host/<project>.
+func publicKeyFromDSN(dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return ""
+	}
+	return u.User.Username()
+}
+
+// parseEnvelope splits an envelope into its header and the payloads of its
+// "event" items. Other item types (sessions, client reports, attachments...)
+// are skipped.
+func parseEnvelope(body []byte) (envelopeHeader, [][]byte, error) {
+	var header envelopeHeader
+	reader := bufio.NewReader(bytes.NewReader(body))
+
+	line, err := readEnvelopeLine(reader)
+	if err != nil {
+		return header, nil, fmt.Errorf("reading envelope header: %w", err)
+	}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return header, nil, fmt.Errorf("invalid envelope header: %w", err)
+	}
+
+	var events [][]byte
+	for {
+		line, err := readEnvelopeLine(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return header, nil, fmt.Errorf("reading item header: %w", err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var item envelopeItemHeader
+		if err := json.Unmarshal(line, &item); err != nil {
+			return header, nil, fmt.Errorf("invalid item header: %w", err)
+		}
+
+		var payload []byte
+		if item.Length != nil {
+			if *item.Length < 0 || *item.Length > len(body) {
+				return header, nil, fmt.Errorf("invalid item length %d", *item.Length)
+			}
+			payload = make([]byte, *item.Length)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return header, nil, fmt.Errorf("reading %s item: %w", item.Type, err)
+			}
+			// Consume the optional newline that terminates the payload.
+			if next, err := reader.Peek(1); err == nil && next[0] == '\n' {
+				reader.ReadByte()
+			}
+		} else {
+			payload, err = readEnvelopeLine(reader)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return header, nil, fmt.Errorf("reading %s item: %w", item.Type, err)
+			}
+		}
+
+		if item.Type == "event" {
+			events = append(events, payload)
+		}
+	}
+
+	return header, events, nil
+}
+
+// readEnvelopeLine reads up to the next newline. A final line without a
+// trailing newline is returned as-is; io.EOF is only returned once nothing is left.
+func readEnvelopeLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && len(line) > 0 {
+		return line, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// translateSentryEvent maps a Sentry event payload onto the unbit event model.
+func translateSentryEvent(payload []byte) (string, models.Event, error) {
+	var se sentryEvent
+	if err := json.Unmarshal(payload, &se); err != nil {
+		return "", models.Event{}, fmt.Errorf("invalid event payload: %w", err)
+	}
+
+	props := models.Properties{
+		Level:       strings.ToLower(se.Level),
+		Runtime:     se.Contexts["runtime"],
+		OS:          se.Contexts["os"],
+		Fingerprint: se.Fingerprint,
+		Release:     truncateString(se.Release, maxReleaseLength),
+		Environment: truncateString(se.Environment, maxEnvironmentLength),
+	}
+	if props.Level == "" {
+		props.Level = "error"
+	}
+
+	if se.ServerName != "" {
+		host, _ := json.Marshal(map[string]string{"hostname": se.ServerName})
+		props.Host = host
+	}
+
+	if raw, ok := se.Extra["sys.argv"]; ok {
+		_ = json.Unmarshal(raw, &props.Argv)
+	}
+	if len(se.Extra) > 0 {
+		if extra, err := json.Marshal(se.Extra); err == nil && len(extra) <= maxExtraSize {
+			props.Extra = extra
+		}
+	}
+
+	props.Breadcrumbs = sentryBreadcrumbs(se.Breadcrumbs)
+	props.Tags = sentryTags(se.Tags)
+	props.User = translateSentryUser(se.User)
+	if se.Request != nil && (se.Request.URL != "" || se.Request.Method != "") {
+		props.Request = &models.Request{
+			URL:     se.Request.URL,
+			Method:  strings.ToUpper(se.Request.Method),
+			Headers: sentryPairs(se.Request.Headers),
+		}
+	}
+
+	// Sentry orders chained exceptions oldest first, we start with the one raised
+	exceptions := sentryExceptions(se.Exception)
+	if len(exceptions) > maxExceptions {
+		exceptions = exceptions[len(exceptions)-maxExceptions:]
+	}
+	for i := len(exceptions) - 1; i >= 0; i-- {
+		exc := exceptions[i]
+		translated := models.Exception{
+			Type:       truncateString(exc.Type, maxTypeLength),
+			Value:      truncateString(exc.Value, maxMessageLength),
+			Module:     exc.Module,
+			Stacktrace: sentryFrames(exc.Stacktrace),
+		}
+		if exc.Mechanism != nil && exc.Mechanism.Type != "" {
+			translated.Mechanism = &models.Mechanism{
+				Type:        exc.Mechanism.Type,
+				Handled:     exc.Mechanism.Handled,
+				Description: exc.Mechanism.Description,
+			}
+		}
+		props.Exceptions = append(props.Exceptions, translated)
+	}
+	if len(props.Exceptions) > 0 {
+		raised := props.Exceptions[0]
+		props.Type = raised.Type
+		props.Message = raised.Value
+		props.Stacktrace = raised.Stacktrace
+	}
+
+	props.Threads = sentryThreads(se.Threads)
+
+	if props.Message == "" {
+		props.Message = sentryMessage(se)
+	}
+	if props.Type == "" {
+		props.Type = se.Logger
+	}
+
+	// SDKs don't apply our limits, so trim rather than reject: keep the
+	// innermost frames and the start of the message.
+	props.Stacktrace = trimFrames(props.Stacktrace)
+	props.Message = truncateString(props.Message, maxMessageLength)
+
+	return se.EventID, models.Event{
+		Timestamp:  sentryTimestamp(se.Timestamp),
+		Properties: props,
+	}, nil
+}
+
+// sentryBreadcrumbs accepts both {"values": [...]} and a bare list, keeping
+// the most recent entries.
+func sentryBreadcrumbs(raw json.RawMessage) []models.Breadcrumb {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var crumbs []sentryBreadcrumb
+	var wrapped struct {
+		Values []sentryBreadcrumb `json:"values"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err == nil {
+		crumbs = wrapped.Values
+	} else if err := json.Unmarshal(raw, &crumbs); err != nil {
+		return nil
+	}
+	if len(crumbs) > maxBreadcrumbs {
+		crumbs = crumbs[len(crumbs)-maxBreadcrumbs:]
+	}
+
+	out := make([]models.Breadcrumb, 0, len(crumbs))
+	for _, b := range crumbs {
+		message := truncateString(b.Message, maxMessageLength)
+		out = append(out, models.Breadcrumb{
+			Timestamp: sentryTimestamp(b.Timestamp),
+			Type:      b.Type,
+			Category:  b.Category,
+			Level:     strings.ToLower(b.Level),
+			Message:   message,
+			Data:      b.Data,
+		})
+	}
+	return out
+}
+
+// sentryTags accepts both an object and a list of [key, value] pairs. Tags
+// we couldn't search by are dropped and long values are cut.
+func sentryTags(raw json.RawMessage) map[string]string {
+	pairs := sentryPairs(raw)
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	// Sorted so the same tags are kept every time there are too many
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tags := make(map[string]string, min(len(pairs), maxTags))
+	for _, key := range keys {
+		if len(tags) == maxTags {
+			break
+		}
+		if key == "" || len(key) > maxTagKeyLength || !validTagKey(key) {
+			continue
+		}
+		tags[key] = truncateString(pairs[key], maxTagValueLength)
+	}
+	return tags
+}
+
+// sentryPairs reads a string map sent either as an object or as a list of
+// [key, value] pairs, as Sentry does for tags and headers.
+func sentryPairs(raw json.RawMessage) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err == nil {
+		out := make(map[string]string, len(object))
+		for k, v := range object {
+			out[k] = jsonString(v)
+		}
+		return out
+	}
+
+	var list [][]json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		out := make(map[string]string, len(list))
+		for _, pair := range list {
+			if len(pair) == 2 {
+				out[jsonString(pair[0])] = jsonString(pair[1])
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// jsonString returns a JSON string's value, or the raw JSON for other types.
+func jsonString(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return string(raw)
+}
+
+func translateSentryUser(u *sentryUser) *models.User {
+	if u == nil {
+		return nil
+	}
+
+	user := &models.User{
+		Email:     u.Email,
+		IPAddress: u.IPAddress,
+		Username:  u.Username,
+	}
+	// "{{auto}}" asks the server to fill in the client address, which we don't record
+	if user.IPAddress == "{{auto}}" {
+		user.IPAddress = ""
+	}
+	if len(u.ID) > 0 && string(u.ID) != "null" {
+		user.ID = jsonString(u.ID)
+	}
+	if *user == (models.User{}) {
+		return nil
+	}
+	return user
+}
+
+// sentryFrames translates a Sentry stacktrace, keeping the innermost frames
+// when there are too many. Minified code and generated names easily run past
+// our field limits, so they are cut to size here rather than rejected by
+// normalizeEvent.
+func sentryFrames(st *sentryStacktrace) []models.Frame {
+	if st == nil {
+		return nil
+	}
+
+	frames := make([]models.Frame, 0, len(st.Frames))
+	for _, f := range st.Frames {
+		file := f.Filename
+		if file == "" {
+			file = f.AbsPath
+		}
+		function := f.Function
+		if function == "" {
+			function = f.Module
+		}
+		frames = append(frames, models.Frame{
+			Function:    truncateString(function, maxFrameFieldSize),
+			File:        truncateString(file, maxFrameFieldSize),
+			Line:        max(f.Lineno, 0),
+			Code:        truncateString(f.ContextLine, maxFrameFieldSize),
+			Column:      f.Colno,
+			Module:      truncateString(f.Module, maxFrameFieldSize),
+			InApp:       f.InApp,
+			PreContext:  f.PreContext,
+			PostContext: f.PostContext,
+			Vars:        f.Vars,
+		})
+	}
+	return trimFrames(frames)
+}
+
+func trimFrames(frames []models.Frame) []models.Frame {
+	if len(frames) > maxStackFrames {
+		return frames[len(frames)-maxStackFrames:]
+	}
+	return frames
+}
+
+// sentryThreads accepts both {"values": [...]} and a bare list.
+func sentryThreads(raw json.RawMessage) []models.ThreadStack {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var threads []sentryThread
+	var wrapped struct {
+		Values []sentryThread `json:"values"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err == nil {
+		threads = wrapped.Values
+	} else if err := json.Unmarshal(raw, &threads); err != nil {
+		return nil
+	}
+	if len(threads) > maxThreads {
+		// Keep the crashed and current threads, grouping and the UI use them
+		sort.SliceStable(threads, func(i, j int) bool {
+			return threadRank(threads[i]) < threadRank(threads[j])
+		})
+		threads = threads[:maxThreads]
+	}
+
+	out := make([]models.ThreadStack, 0, len(threads))
+	for _, t := range threads {
+		thread := models.ThreadStack{
+			Name:       t.Name,
+			Crashed:    t.Crashed,
+			Current:    t.Current,
+			Stacktrace: sentryFrames(t.Stacktrace),
+		}
+		if len(t.ID) > 0 && string(t.ID) != "null" {
+			thread.ID = jsonString(t.ID)
+		}
+		out = append(out, thread)
+	}
+	return out
+}
+
+func threadRank(t sentryThread) int {
+	switch {
+	case t.Crashed:
+		return 0
+	case t.Current:
+		return 1
+	}
+	return 2
+}
+
+// sentryExceptions accepts both {"values": [...]} and the legacy bare list.
+func sentryExceptions(raw json.RawMessage) []sentryException {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var wrapped struct {
+		Values []sentryException `json:"values"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err == nil {
+		return wrapped.Values
+	}
+
+	var list []sentryException
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	return nil
+}
+
+func sentryMessage(se sentryEvent) string {
+	if se.LogEntry != nil {
+		if se.LogEntry.Formatted != "" {
+			return se.LogEntry.Formatted
+		}
+		if se.LogEntry.Message != "" {
+			return se.LogEntry.Message
+		}
+	}
+
+	if len(se.Message) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(se.Message, &text); err == nil {
+		return text
+	}
+
+	var entry sentryLogEntry
+	if err := json.Unmarshal(se.Message, &entry); err == nil {
+		if entry.Formatted != "" {
+			return entry.Formatted
+		}
+		return entry.Message
+	}
+	return ""
+}
+
+// sentryTimestamp parses either a unix timestamp in (fractional) seconds or an
+// RFC 3339 string, falling back to the time of receipt.
+func sentryTimestamp(raw json.RawMessage) time.Time {
+	if len(raw) == 0 {
+		return time.Now().UTC()
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err == nil {
+		whole, frac := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+			if t, err := time.Parse(layout, text); err == nil {
+				return t.UTC()
+			}
+		}
+	}
+
+	return time.Now().UTC()
+}
@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+const (
+	dsnCacheTTL        = 5 * time.Minute
+	dsnMissingCacheTTL = time.Minute
+)
+
+var (
+	errUnknownToken  = errors.New("unknown DSN token")
+	errDisabledToken = errors.New("DSN token is disabled")
+)
+
+type projectKey struct {
+	ProjectID string `db:"id" json:"projectId"`
+	Enabled   bool   `db:"dsn_enabled" json:"enabled"`
+}
+
+// resolveToken maps a DSN token to its project, going through Redis before
+// hitting projects.dsn_token. Unknown tokens are cached too, for a shorter
+// time, so a misconfigured SDK can't hammer the database.
+func (v *IngestContext) resolveToken(ctx context.Context, token string) (projectKey, error) {
+	var key projectKey
+	cacheKey := utils.DSNCachePrefix + token
+
+	if cached, err := v.Cache.Get(ctx, cacheKey).Bytes(); err == nil {
+		if err := json.Unmarshal(cached, &key); err == nil {
+			return key, checkProjectKey(key)
+		}
+	}
+
+	err := v.DB.GetContext(ctx, &key, `SELECT id, dsn_enabled FROM projects WHERE dsn_token = $1`, token)
+	ttl := dsnCacheTTL
+	if errors.Is(err, sql.ErrNoRows) {
+		key = projectKey{}
+		ttl = dsnMissingCacheTTL
+	} else if err != nil {
+		return key, err
+	}
+
+	if data, err := json.Marshal(key); err == nil {
+		v.Cache.Set(ctx, cacheKey, data, ttl)
+	}
+
+	return key, checkProjectKey(key)
+}
+
+func checkProjectKey(key projectKey) error {
+	if key.ProjectID == "" {
+		return errUnknownToken
+	}
+	if !key.Enabled {
+		return errDisabledToken
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/santoshkpatro/unbit/internal/models"
+	"github.com/santoshkpatro/unbit/internal/worker"
+)
+
+const (
+	maxEventBodySize     = 1 << 20
+	maxMessageLength     = 8192
+	maxTypeLength        = 256
+	maxStackFrames       = 256
+	maxFrameFieldSize    = 1024
+	maxFutureSkew        = time.Hour
+	maxBreadcrumbs       = 100
+	maxTags              = 50
+	maxTagKeyLength      = 32
+	maxTagValueLength    = worker.MaxTagValue
+	maxExtraSize         = 64 << 10
+	maxExceptions        = 16
+	maxThreads           = 64
+	maxContextLines      = 10
+	maxFrameVars         = 50
+	maxFrameVarSize      = 1024
+	maxReleaseLength     = 200
+	maxEnvironmentLength = 64
+)
+
+// filteredHeaders carry credentials and are never stored.
+var filteredHeaders = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"set-cookie":    true,
+	"x-sentry-auth": true,
+}
+
+var eventLevels = map[string]bool{
+	"debug":   true,
+	"info":    true,
+	"warning": true,
+	"error":   true,
+	"fatal":   true,
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// normalizeEvent fills in defaults and returns every problem found with the
+// event, so SDK authors can fix them all in one go.
+func normalizeEvent(event *models.Event) []fieldError {
+	var errs []fieldError
+	props := &event.Properties
+
+	// Clients with a clock running ahead still report real errors, they are
+	// dated when received instead
+	now := time.Now().UTC()
+	if event.Timestamp.IsZero() || event.Timestamp.After(now.Add(maxFutureSkew)) {
+		event.Timestamp = now
+	}
+
+	props.Level = strings.ToLower(props.Level)
+	if props.Level == "" {
+		props.Level = "error"
+	} else if props.Level == "warn" {
+		props.Level = "warning"
+	}
+	if !eventLevels[props.Level] {
+		errs = append(errs, fieldError{"properties.level", "must be one of debug, info, warning, error, fatal"})
+	}
+
+	// The first exception of a chain is the one raised, the flat fields mirror it
+	if len(props.Exceptions) > 0 {
+		raised := props.Exceptions[0]
+		if props.Type == "" {
+			props.Type = raised.Type
+		}
+		if props.Message == "" {
+			props.Message = raised.Value
+		}
+		if len(props.Stacktrace) == 0 {
+			props.Stacktrace = raised.Stacktrace
+		}
+	}
+
+	if props.Type == "" && props.Message == "" {
+		errs = append(errs, fieldError{"properties.message", "either type or message is required"})
+	}
+	if len(props.Type) > maxTypeLength {
+		errs = append(errs, fieldError{"properties.type", fmt.Sprintf("must be at most %d characters", maxTypeLength)})
+	}
+	if len(props.Message) > maxMessageLength {
+		errs = append(errs, fieldError{"properties.message", fmt.Sprintf("must be at most %d characters", maxMessageLength)})
+	}
+
+	if len(props.Release) > maxReleaseLength {
+		errs = append(errs, fieldError{"properties.release", fmt.Sprintf("must be at most %d characters", maxReleaseLength)})
+	}
+	if len(props.Environment) > maxEnvironmentLength {
+		errs = append(errs, fieldError{"properties.environment", fmt.Sprintf("must be at most %d characters", maxEnvironmentLength)})
+	}
+
+	trimFrameDetails(props.Stacktrace)
+	for _, exc := range props.Exceptions {
+		trimFrameDetails(exc.Stacktrace)
+	}
+	for _, thread := range props.Threads {
+		trimFrameDetails(thread.Stacktrace)
+	}
+
+	errs = append(errs, validateFrames("properties.stacktrace", props.Stacktrace)...)
+
+	if len(props.Exceptions) > maxExceptions {
+		errs = append(errs, fieldError{"properties.exceptions", fmt.Sprintf("must have at most %d entries", maxExceptions)})
+	}
+	for i, exc := range props.Exceptions {
+		field := fmt.Sprintf("properties.exceptions[%d]", i)
+		if len(exc.Type) > maxTypeLength {
+			errs = append(errs, fieldError{field + ".type", fmt.Sprintf("must be at most %d characters", maxTypeLength)})
+		}
+		if len(exc.Value) > maxMessageLength {
+			errs = append(errs, fieldError{field + ".value", fmt.Sprintf("must be at most %d characters", maxMessageLength)})
+		}
+		errs = append(errs, validateFrames(field+".stacktrace", exc.Stacktrace)...)
+	}
+
+	if len(props.Threads) > maxThreads {
+		errs = append(errs, fieldError{"properties.threads", fmt.Sprintf("must have at most %d entries", maxThreads)})
+	}
+	for i, thread := range props.Threads {
+		errs = append(errs, validateFrames(fmt.Sprintf("properties.threads[%d].stacktrace", i), thread.Stacktrace)...)
+	}
+
+	if err := worker.ValidateFingerprint(props.Fingerprint); err != nil {
+		errs = append(errs, fieldError{"properties.fingerprint", err.Error()})
+	}
+
+	if len(props.Breadcrumbs) > maxBreadcrumbs {
+		errs = append(errs, fieldError{"properties.breadcrumbs", fmt.Sprintf("must have at most %d entries", maxBreadcrumbs)})
+	}
+	for i := range props.Breadcrumbs {
+		if props.Breadcrumbs[i].Timestamp.IsZero() {
+			props.Breadcrumbs[i].Timestamp = event.Timestamp
+		}
+		if len(props.Breadcrumbs[i].Message) > maxMessageLength {
+			errs = append(errs, fieldError{
+				fmt.Sprintf("properties.breadcrumbs[%d].message", i),
+				fmt.Sprintf("must be at most %d characters", maxMessageLength),
+			})
+		}
+	}
+
+	if len(props.Tags) > maxTags {
+		errs = append(errs, fieldError{"properties.tags", fmt.Sprintf("must have at most %d tags", maxTags)})
+	}
+	for key, value := range props.Tags {
+		if key == "" || len(key) > maxTagKeyLength || !validTagKey(key) {
+			errs = append(errs, fieldError{"properties.tags", fmt.Sprintf("key %q must be 1 to %d letters, digits, _, - or .", key, maxTagKeyLength)})
+		}
+		if len(value) > maxTagValueLength {
+			errs = append(errs, fieldError{"properties.tags", fmt.Sprintf("value of %q must be at most %d characters", key, maxTagValueLength)})
+		}
+	}
+
+	if props.Request != nil {
+		for name := range props.Request.Headers {
+			if filteredHeaders[strings.ToLower(name)] {
+				props.Request.Headers[name] = "[Filtered]"
+			}
+		}
+	}
+
+	if len(props.Extra) > 0 {
+		var extra map[string]json.RawMessage
+		if err := json.Unmarshal(props.Extra, &extra); err != nil {
+			errs = append(errs, fieldError{"properties.extra", "must be an object"})
+		} else if len(props.Extra) > maxExtraSize {
+			errs = append(errs, fieldError{"properties.extra", fmt.Sprintf("must be at most %d bytes", maxExtraSize)})
+		}
+	}
+
+	return errs
+}
+
+// trimFrameDetails cuts source context and locals down to size instead of
+// rejecting the event, since SDKs send whatever the frame happens to hold.
+func trimFrameDetails(frames []models.Frame) {
+	for i := range frames {
+		f := &frames[i]
+		f.Module = truncateString(f.Module, maxFrameFieldSize)
+		// Only the worker resolves frames through source maps
+		f.Raw = nil
+
+		// Keep the lines closest to the failing one
+		if len(f.PreContext) > maxContextLines {
+			f.PreContext = f.PreContext[len(f.PreContext)-maxContextLines:]
+		}
+		if len(f.PostContext) > maxContextLines {
+			f.PostContext = f.PostContext[:maxContextLines]
+		}
+		for j := range f.PreContext {
+			f.PreContext[j] = truncateString(f.PreContext[j], maxFrameFieldSize)
+		}
+		for j := range f.PostContext {
+			f.PostContext[j] = truncateString(f.PostContext[j], maxFrameFieldSize)
+		}
+
+		if len(f.Vars) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(f.Vars))
+		for name := range f.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		vars := make(map[string]json.RawMessage, min(len(names), maxFrameVars))
+		for _, name := range names[:min(len(names), maxFrameVars)] {
+			value := f.Vars[name]
+			if len(value) > maxFrameVarSize {
+				// Too big to keep whole, show the start of it as a string
+				value, _ = json.Marshal(truncateString(string(value), maxFrameVarSize) + "...")
+			}
+			vars[truncateString(name, maxTypeLength)] = value
+		}
+		f.Vars = vars
+	}
+}
+
+// truncateString cuts s to at most n bytes without splitting a character.
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func validateFrames(field string, frames []models.Frame) []fieldError {
+	var errs []fieldError
+	if len(frames) > maxStackFrames {
+		errs = append(errs, fieldError{field, fmt.Sprintf("must have at most %d frames", maxStackFrames)})
+	}
+	for i, frame := range frames {
+		if len(frame.Function) > maxFrameFieldSize || len(frame.File) > maxFrameFieldSize || len(frame.Code) > maxFrameFieldSize {
+			errs = append(errs, fieldError{
+				fmt.Sprintf("%s[%d]", field, i),
+				fmt.Sprintf("function, file and code must be at most %d characters", maxFrameFieldSize),
+			})
+		}
+		if frame.Line < 0 {
+			errs = append(errs, fieldError{fmt.Sprintf("%s[%d].line", field, i), "must not be negative"})
+		}
+	}
+	return errs
+}
+
+// validTagKey allows the characters tags can be searched by.
+func validTagKey(key string) bool {
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
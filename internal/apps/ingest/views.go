@@ -1,47 +1,172 @@
 package ingest
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/santoshkpatro/unbit/internal/models"
 	"github.com/santoshkpatro/unbit/internal/utils"
+	"github.com/santoshkpatro/unbit/internal/worker"
 )
 
 func (v *IngestContext) NewEvent(c echo.Context) error {
-	var queue = "issues"
+	token := c.Request().Header.Get("X-Unbit-Token")
+	if token == "" {
+		return utils.RespondFail(c, http.StatusUnauthorized, "Missing X-Unbit-Token header", nil)
+	}
+
+	key, err := v.resolveToken(c.Request().Context(), token)
+	if err != nil {
+		return respondTokenError(c, err)
+	}
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxEventBodySize)
+
 	var event models.Event
 	if err := c.Bind(&event); err != nil {
-		utils.RespondFail(c, http.StatusBadRequest, "Failed", nil)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return utils.RespondFail(c, http.StatusRequestEntityTooLarge, "Request body too large", []fieldError{
+				{"body", "must be at most 1MB"},
+			})
+		}
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid event", []fieldError{
+			{"body", err.Error()},
+		})
 	}
 
-	for _, frame := range event.Properties.Stacktrace {
-		fmt.Printf("     ↳ %s (%s:%d)\n", frame.Function, frame.File, frame.Line)
+	if errs := normalizeEvent(&event); len(errs) > 0 {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid event", errs)
 	}
 
-	token := c.Request().Header.Get("X-Unbit-Token")
+	if err := v.enqueueEvent(c.Request().Context(), token, key, event); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to queue event", nil)
+	}
+
+	return utils.RespondOK(c, nil, "Recived success")
+}
 
+// SentryStoreEvent accepts a single event posted by a Sentry SDK to
+// /api/:project/store/.
+func (v *IngestContext) SentryStoreEvent(c echo.Context) error {
+	token := sentryPublicKey(c.Request())
 	if token == "" {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "missing X-Unbit-Token header",
-		})
+		return utils.RespondFail(c, http.StatusUnauthorized, "Missing sentry_key", nil)
 	}
 
-	payload := models.Payload{
-		DSNToken: token,
-		Event:    event,
+	key, err := v.resolveToken(c.Request().Context(), token)
+	if err != nil {
+		return respondTokenError(c, err)
+	}
+	// The DSN names the project in the path as well as by its key
+	if c.Param("project") != key.ProjectID {
+		return utils.RespondFail(c, http.StatusForbidden, "DSN token does not belong to this project", nil)
+	}
+
+	body, err := readSentryBody(c.Request())
+	if err != nil {
+		return respondBodyError(c, err)
 	}
 
-	data, err := json.Marshal(payload)
+	eventID, event, err := translateSentryEvent(body)
 	if err != nil {
-		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to marshal event", nil)
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid event", []fieldError{
+			{"body", err.Error()},
+		})
+	}
+
+	if errs := normalizeEvent(&event); len(errs) > 0 {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid event", errs)
 	}
 
-	if err := v.Cache.LPush(c.Request().Context(), queue, data).Err(); err != nil {
+	if err := v.enqueueEvent(c.Request().Context(), token, key, event); err != nil {
 		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to queue event", nil)
 	}
 
-	return utils.RespondOK(c, nil, "Recived success")
+	return c.JSON(http.StatusOK, map[string]string{"id": eventID})
+}
+
+// SentryEnvelope accepts a Sentry envelope posted to /api/:project/envelope/.
+// Only "event" items are ingested, everything else is acknowledged and dropped.
+func (v *IngestContext) SentryEnvelope(c echo.Context) error {
+	body, err := readSentryBody(c.Request())
+	if err != nil {
+		return respondBodyError(c, err)
+	}
+
+	header, payloads, err := parseEnvelope(body)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid envelope", []fieldError{
+			{"body", err.Error()},
+		})
+	}
+
+	token := sentryPublicKey(c.Request())
+	if token == "" {
+		token = publicKeyFromDSN(header.DSN)
+	}
+	if token == "" {
+		return utils.RespondFail(c, http.StatusUnauthorized, "Missing sentry_key", nil)
+	}
+
+	key, err := v.resolveToken(c.Request().Context(), token)
+	if err != nil {
+		return respondTokenError(c, err)
+	}
+	// The DSN names the project in the path as well as by its key
+	if c.Param("project") != key.ProjectID {
+		return utils.RespondFail(c, http.StatusForbidden, "DSN token does not belong to this project", nil)
+	}
+
+	events := make([]models.Event, 0, len(payloads))
+	for _, payload := range payloads {
+		_, event, err := translateSentryEvent(payload)
+		if err != nil {
+			return utils.RespondFail(c, http.StatusBadRequest, "Invalid event", []fieldError{
+				{"body", err.Error()},
+			})
+		}
+		if errs := normalizeEvent(&event); len(errs) > 0 {
+			return utils.RespondFail(c, http.StatusBadRequest, "Invalid event", errs)
+		}
+		events = append(events, event)
+	}
+
+	for _, event := range events {
+		if err := v.enqueueEvent(c.Request().Context(), token, key, event); err != nil {
+			return utils.RespondFail(c, http.StatusInternalServerError, "Failed to queue event", nil)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"id": header.EventID})
+}
+
+func (v *IngestContext) enqueueEvent(ctx context.Context, token string, key projectKey, event models.Event) error {
+	return worker.Enqueue(ctx, v.Cache, models.Payload{
+		DSNToken:  token,
+		ProjectID: key.ProjectID,
+		Event:     event,
+	})
+}
+
+func respondTokenError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, errUnknownToken):
+		return utils.RespondFail(c, http.StatusUnauthorized, "Invalid DSN token", nil)
+	case errors.Is(err, errDisabledToken):
+		return utils.RespondFail(c, http.StatusForbidden, "DSN token is disabled", nil)
+	default:
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to verify DSN token", nil)
+	}
+}
+
+func respondBodyError(c echo.Context, err error) error {
+	if errors.Is(err, errBodyTooLarge) {
+		return utils.RespondFail(c, http.StatusRequestEntityTooLarge, "Request body too large", nil)
+	}
+	return utils.RespondFail(c, http.StatusBadRequest, "Invalid request body", []fieldError{
+		{"body", err.Error()},
+	})
 }
@@ -2,6 +2,7 @@ package issues
 
 import (
 	"encoding/json"
+	"math"
 	"time"
 )
 
@@ -29,10 +30,17 @@ type FirstStackTrace struct {
 }
 
 type Stacktrace struct {
-	Function string `json:"function"`
-	File     string `json:"file"`
-	Line     int    `json:"line"`
-	Code     string `json:"code"`
+	Function    string                     `json:"function"`
+	File        string                     `json:"file"`
+	Line        int                        `json:"line"`
+	Code        string                     `json:"code"`
+	Column      int                        `json:"column,omitempty"`
+	Module      string                     `json:"module,omitempty"`
+	InApp       *bool                      `json:"inApp,omitempty"`
+	PreContext  []string                   `json:"preContext,omitempty"`
+	PostContext []string                   `json:"postContext,omitempty"`
+	Vars        map[string]json.RawMessage `json:"vars,omitempty"`
+	Raw         *Stacktrace                `json:"raw,omitempty"`
 }
 
 type Issue struct {
@@ -41,6 +49,7 @@ type Issue struct {
 	EventCount      int                `json:"eventCount"`
 	Timestamp       time.Time          `json:"timestamp"`
 	Status          string             `json:"status"`
+	IsRegression    bool               `json:"isRegression"`
 	Message         string             `json:"message"`
 	Level           string             `json:"level"`
 	Type            string             `json:"type"`
@@ -52,23 +61,38 @@ type Issue struct {
 }
 
 type IssueDetail struct {
-	ID         string          `json:"id"`
-	EventID    string          `json:"eventId"`
-	EventCount int             `json:"eventCount"`
-	Timestamp  time.Time       `json:"timestamp"`
-	Status     string          `json:"status"`
-	Message    string          `json:"message"`
-	Level      string          `json:"level"`
-	Type       string          `json:"type"`
-	Assignee   *Assignee       `json:"assignee"`
-	Project    Project         `json:"project"`
-	Stacktrace []Stacktrace    `json:"stacktrace"`
-	Age        int             `json:"age"`
-	Runtime    json.RawMessage `json:"runtime"`
-	OS         json.RawMessage `json:"os"`
-	Process    json.RawMessage `json:"process"`
-	Thread     json.RawMessage `json:"thread"`
-	Host       json.RawMessage `json:"host"`
+	ID           string             `json:"id"`
+	EventID      string             `json:"eventId"`
+	EventCount   int                `json:"eventCount"`
+	IssueCount   []IssueCountReport `json:"issueCountReport"`
+	Timestamp    time.Time          `json:"timestamp"`
+	Status       string             `json:"status"`
+	IsRegression bool               `json:"isRegression"`
+	Message      string             `json:"message"`
+	Level        string             `json:"level"`
+	Type         string             `json:"type"`
+	Assignee     *Assignee          `json:"assignee"`
+	AssignedBy   *string            `json:"assignedBy"`
+	AssignedAt   *time.Time         `json:"assignedAt"`
+	Release      string             `json:"release"`
+	Environment  string             `json:"environment"`
+	FirstRelease *string            `json:"firstRelease"`
+	LastRelease  *string            `json:"lastRelease"`
+	Project      Project            `json:"project"`
+	Stacktrace   []Stacktrace       `json:"stacktrace"`
+	Age          int                `json:"age"`
+	Runtime      json.RawMessage    `json:"runtime"`
+	OS           json.RawMessage    `json:"os"`
+	Process      json.RawMessage    `json:"process"`
+	Thread       json.RawMessage    `json:"thread"`
+	Host         json.RawMessage    `json:"host"`
+	Breadcrumbs  json.RawMessage    `json:"breadcrumbs"`
+	Tags         json.RawMessage    `json:"tags"`
+	User         json.RawMessage    `json:"user"`
+	Request      json.RawMessage    `json:"request"`
+	Extra        json.RawMessage    `json:"extra"`
+	Exceptions   json.RawMessage    `json:"exceptions"`
+	Threads      json.RawMessage    `json:"threads"`
 }
 
 type issueRow struct {
@@ -77,6 +101,7 @@ type issueRow struct {
 	EventCount       int             `db:"event_count"`
 	Timestamp        time.Time       `db:"timestamp"`
 	Status           string          `db:"status"`
+	IsRegression     bool            `db:"is_regression"`
 	Message          string          `db:"message"`
 	Level            string          `db:"level"`
 	Type             string          `db:"type"`
@@ -96,12 +121,19 @@ type issueDetailRow struct {
 	EventCount       int             `db:"event_count"`
 	Timestamp        time.Time       `db:"timestamp"`
 	Status           string          `db:"status"`
+	IsRegression     bool            `db:"is_regression"`
 	Message          string          `db:"message"`
 	Level            string          `db:"level"`
 	Type             string          `db:"type"`
 	AssigneeID       *string         `db:"assignee_id"`
 	AssigneeName     *string         `db:"assignee_name"`
 	AssigneeEmail    *string         `db:"assignee_email"`
+	AssignedBy       *string         `db:"assigned_by"`
+	AssignedAt       *time.Time      `db:"assigned_at"`
+	Release          string          `db:"release"`
+	Environment      string          `db:"environment"`
+	FirstRelease     *string         `db:"first_release"`
+	LastRelease      *string         `db:"last_release"`
 	ProjectID        string          `db:"project_id"`
 	ProjectName      string          `db:"project_name"`
 	IssueCountReport json.RawMessage `db:"issue_count_report"`
@@ -112,6 +144,13 @@ type issueDetailRow struct {
 	Process          json.RawMessage `db:"process"`
 	Thread           json.RawMessage `db:"thread"`
 	Host             json.RawMessage `db:"host"`
+	Breadcrumbs      json.RawMessage `db:"breadcrumbs"`
+	Tags             json.RawMessage `db:"tags"`
+	User             json.RawMessage `db:"user"`
+	Request          json.RawMessage `db:"request"`
+	Extra            json.RawMessage `db:"extra"`
+	Exceptions       json.RawMessage `db:"exceptions"`
+	Threads          json.RawMessage `db:"threads"`
 }
 
 func (ir *issueRow) ToIssue() (Issue, error) {
@@ -137,15 +176,16 @@ func (ir *issueRow) ToIssue() (Issue, error) {
 	}
 
 	return Issue{
-		ID:         ir.ID,
-		EventID:    ir.EventID,
-		EventCount: ir.EventCount,
-		Timestamp:  ir.Timestamp,
-		Status:     ir.Status,
-		Message:    ir.Message,
-		Level:      ir.Level,
-		Type:       ir.Type,
-		Assignee:   assignee,
+		ID:           ir.ID,
+		EventID:      ir.EventID,
+		EventCount:   ir.EventCount,
+		Timestamp:    ir.Timestamp,
+		Status:       ir.Status,
+		IsRegression: ir.IsRegression,
+		Message:      ir.Message,
+		Level:        ir.Level,
+		Type:         ir.Type,
+		Assignee:     assignee,
 		Project: Project{
 			ID:   ir.ProjectID,
 			Name: ir.ProjectName,
@@ -162,6 +202,11 @@ func (ir *issueDetailRow) ToIssueDetail() (IssueDetail, error) {
 		return IssueDetail{}, err
 	}
 
+	var issueCount []IssueCountReport
+	if err := json.Unmarshal(ir.IssueCountReport, &issueCount); err != nil {
+		return IssueDetail{}, err
+	}
+
 	var assignee *Assignee = nil
 
 	if ir.AssigneeID != nil {
@@ -173,26 +218,41 @@ func (ir *issueDetailRow) ToIssueDetail() (IssueDetail, error) {
 	}
 
 	return IssueDetail{
-		ID:         ir.ID,
-		EventID:    ir.EventID,
-		EventCount: ir.EventCount,
-		Timestamp:  ir.Timestamp,
-		Status:     ir.Status,
-		Message:    ir.Message,
-		Level:      ir.Level,
-		Type:       ir.Type,
-		Assignee:   assignee,
+		ID:           ir.ID,
+		EventID:      ir.EventID,
+		EventCount:   ir.EventCount,
+		IssueCount:   issueCount,
+		Timestamp:    ir.Timestamp,
+		Status:       ir.Status,
+		IsRegression: ir.IsRegression,
+		Message:      ir.Message,
+		Level:        ir.Level,
+		Type:         ir.Type,
+		Assignee:     assignee,
+		AssignedBy:   ir.AssignedBy,
+		AssignedAt:   ir.AssignedAt,
+		Release:      ir.Release,
+		Environment:  ir.Environment,
+		FirstRelease: ir.FirstRelease,
+		LastRelease:  ir.LastRelease,
 		Project: Project{
 			ID:   ir.ProjectID,
 			Name: ir.ProjectName,
 		},
-		Stacktrace: stacktrace,
-		Age:        ir.Age,
-		Runtime:    ir.Runtime,
-		OS:         ir.OS,
-		Process:    ir.Process,
-		Thread:     ir.Thread,
-		Host:       ir.Host,
+		Stacktrace:  stacktrace,
+		Age:         ir.Age,
+		Runtime:     ir.Runtime,
+		OS:          ir.OS,
+		Process:     ir.Process,
+		Thread:      ir.Thread,
+		Host:        ir.Host,
+		Breadcrumbs: ir.Breadcrumbs,
+		Tags:        ir.Tags,
+		User:        ir.User,
+		Request:     ir.Request,
+		Extra:       ir.Extra,
+		Exceptions:  ir.Exceptions,
+		Threads:     ir.Threads,
 	}, nil
 }
 
@@ -204,3 +264,275 @@ type eventRow struct {
 	Level     string    `db:"level" json:"level"`
 	CreatedAt time.Time `db:"created_at" json:"createdAt"`
 }
+
+type issueMergeData struct {
+	IssueIDs []string `json:"issueIds" validate:"required,min=1,dive,required"`
+}
+
+type issueUnmergeData struct {
+	Fingerprint string `json:"fingerprint" validate:"required"`
+}
+
+type issueRef struct {
+	ID          string `db:"id"`
+	ProjectID   string `db:"project_id"`
+	Fingerprint string `db:"fingerprint"`
+}
+
+type IssueFingerprint struct {
+	Fingerprint string    `db:"fingerprint" json:"fingerprint"`
+	EventCount  int       `db:"event_count" json:"eventCount"`
+	LastSeen    time.Time `db:"last_seen" json:"lastSeen"`
+	IsPrimary   bool      `db:"is_primary" json:"isPrimary"`
+}
+
+type issueIgnoreData struct {
+	DurationMinutes *int   `json:"durationMinutes" validate:"omitempty,min=1"`
+	Count           *int64 `json:"count" validate:"omitempty,min=1"`
+}
+
+type IssueStatus struct {
+	ID                string     `db:"id" json:"id"`
+	Status            string     `db:"status" json:"status"`
+	ResolvedAt        *time.Time `db:"resolved_at" json:"resolvedAt"`
+	IgnoredUntil      *time.Time `db:"ignored_until" json:"ignoredUntil"`
+	IgnoredUntilCount *int64     `db:"ignored_until_count" json:"ignoredUntilCount"`
+	IsRegression      bool       `db:"is_regression" json:"isRegression"`
+}
+
+type Activity struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Data      json.RawMessage `json:"data"`
+	User      *Assignee       `json:"user"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+type activityRow struct {
+	ID        string          `db:"id"`
+	Kind      string          `db:"kind"`
+	Data      json.RawMessage `db:"data"`
+	UserID    *string         `db:"user_id"`
+	UserName  *string         `db:"user_name"`
+	UserEmail *string         `db:"user_email"`
+	CreatedAt time.Time       `db:"created_at"`
+}
+
+func (ar *activityRow) ToActivity() Activity {
+	var user *Assignee = nil
+
+	if ar.UserID != nil {
+		user = &Assignee{
+			ID:    *ar.UserID,
+			Name:  ar.UserName,
+			Email: ar.UserEmail,
+		}
+	}
+
+	return Activity{
+		ID:        ar.ID,
+		Kind:      ar.Kind,
+		Data:      ar.Data,
+		User:      user,
+		CreatedAt: ar.CreatedAt,
+	}
+}
+
+type issueAssignData struct {
+	UserID string `json:"userId" validate:"required"`
+}
+
+type IssueAssignment struct {
+	ID         string     `db:"id" json:"id"`
+	AssigneeID *string    `db:"assignee_id" json:"assigneeId"`
+	AssignedBy *string    `db:"assigned_by" json:"assignedBy"`
+	AssignedAt *time.Time `db:"assigned_at" json:"assignedAt"`
+}
+
+type IssueSummary struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	IsRegression bool       `json:"isRegression"`
+	Level        *string    `json:"level"`
+	Type         *string    `json:"type"`
+	Message      *string    `json:"message"`
+	EventCount   int64      `json:"eventCount"`
+	UserCount    int64      `json:"userCount"`
+	FirstSeen    *time.Time `json:"firstSeen"`
+	LastSeen     *time.Time `json:"lastSeen"`
+	FirstRelease *string    `json:"firstRelease"`
+	LastRelease  *string    `json:"lastRelease"`
+	Assignee     *Assignee  `json:"assignee"`
+	Project      Project    `json:"project"`
+}
+
+type IssuePage struct {
+	Issues     []IssueSummary `json:"issues"`
+	NextCursor string         `json:"nextCursor"`
+}
+
+type issueSummaryRow struct {
+	ID            string     `db:"id"`
+	Status        string     `db:"status"`
+	IsRegression  bool       `db:"is_regression"`
+	Level         *string    `db:"level"`
+	Type          *string    `db:"type"`
+	Message       *string    `db:"message"`
+	EventCount    int64      `db:"event_count"`
+	UserCount     int64      `db:"user_count"`
+	FirstSeenAt   *time.Time `db:"first_seen_at"`
+	LastSeenAt    *time.Time `db:"last_seen_at"`
+	FirstRelease  *string    `db:"first_release"`
+	LastRelease   *string    `db:"last_release"`
+	AssigneeID    *string    `db:"assignee_id"`
+	AssigneeName  *string    `db:"assignee_name"`
+	AssigneeEmail *string    `db:"assignee_email"`
+	ProjectID     string     `db:"project_id"`
+	ProjectName   string     `db:"project_name"`
+}
+
+func (ir *issueSummaryRow) ToIssueSummary() IssueSummary {
+	var assignee *Assignee
+	if ir.AssigneeID != nil {
+		assignee = &Assignee{
+			ID:    *ir.AssigneeID,
+			Name:  ir.AssigneeName,
+			Email: ir.AssigneeEmail,
+		}
+	}
+
+	return IssueSummary{
+		ID:           ir.ID,
+		Status:       ir.Status,
+		IsRegression: ir.IsRegression,
+		Level:        ir.Level,
+		Type:         ir.Type,
+		Message:      ir.Message,
+		EventCount:   ir.EventCount,
+		UserCount:    ir.UserCount,
+		FirstSeen:    ir.FirstSeenAt,
+		LastSeen:     ir.LastSeenAt,
+		FirstRelease: ir.FirstRelease,
+		LastRelease:  ir.LastRelease,
+		Assignee:     assignee,
+		Project: Project{
+			ID:   ir.ProjectID,
+			Name: ir.ProjectName,
+		},
+	}
+}
+
+type EventNavigation struct {
+	Previous *string `json:"previous"`
+	Next     *string `json:"next"`
+	Oldest   *string `json:"oldest"`
+	Latest   *string `json:"latest"`
+}
+
+type EventDetail struct {
+	ID          string          `json:"id"`
+	IssueID     string          `json:"issueId"`
+	ProjectID   string          `json:"projectId"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Fingerprint *string         `json:"fingerprint"`
+	Properties  json.RawMessage `json:"properties"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	Navigation  EventNavigation `json:"navigation"`
+}
+
+type eventDetailRow struct {
+	ID              string          `db:"id"`
+	IssueID         string          `db:"issue_id"`
+	ProjectID       string          `db:"project_id"`
+	Timestamp       time.Time       `db:"timestamp"`
+	Fingerprint     *string         `db:"fingerprint"`
+	Properties      json.RawMessage `db:"properties"`
+	CreatedAt       time.Time       `db:"created_at"`
+	PreviousEventID *string         `db:"previous_event_id"`
+	NextEventID     *string         `db:"next_event_id"`
+	OldestEventID   *string         `db:"oldest_event_id"`
+	LatestEventID   *string         `db:"latest_event_id"`
+}
+
+func (er *eventDetailRow) ToEventDetail() EventDetail {
+	return EventDetail{
+		ID:          er.ID,
+		IssueID:     er.IssueID,
+		ProjectID:   er.ProjectID,
+		Timestamp:   er.Timestamp,
+		Fingerprint: er.Fingerprint,
+		Properties:  er.Properties,
+		CreatedAt:   er.CreatedAt,
+		Navigation: EventNavigation{
+			Previous: er.PreviousEventID,
+			Next:     er.NextEventID,
+			Oldest:   er.OldestEventID,
+			Latest:   er.LatestEventID,
+		},
+	}
+}
+
+type EventLinks struct {
+	Next     *string `json:"next"`
+	Previous *string `json:"previous"`
+	Oldest   string  `json:"oldest"`
+	Latest   string  `json:"latest"`
+}
+
+type EventPage struct {
+	Events []eventRow `json:"events"`
+	Links  EventLinks `json:"links"`
+}
+
+type TagValue struct {
+	Value      string    `json:"value"`
+	Count      int64     `json:"count"`
+	Percentage float64   `json:"percentage"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+type TagFacet struct {
+	Key          string     `json:"key"`
+	TotalValues  int64      `json:"totalValues"`
+	UniqueValues int64      `json:"uniqueValues"`
+	TopValues    []TagValue `json:"topValues"`
+}
+
+type tagValueRow struct {
+	Key          string    `db:"key"`
+	Value        string    `db:"value"`
+	Count        int64     `db:"count"`
+	FirstSeen    time.Time `db:"first_seen"`
+	LastSeen     time.Time `db:"last_seen"`
+	Total        int64     `db:"total"`
+	UniqueValues int64     `db:"unique_values"`
+}
+
+// toTagFacets groups rows ordered by key into one facet per key.
+func toTagFacets(rows []tagValueRow) []TagFacet {
+	facets := []TagFacet{}
+	for _, row := range rows {
+		if len(facets) == 0 || facets[len(facets)-1].Key != row.Key {
+			facets = append(facets, TagFacet{
+				Key:          row.Key,
+				TotalValues:  row.Total,
+				UniqueValues: row.UniqueValues,
+			})
+		}
+		facet := &facets[len(facets)-1]
+
+		percentage := 0.0
+		if row.Total > 0 {
+			percentage = math.Round(float64(row.Count)*1000/float64(row.Total)) / 10
+		}
+		facet.TopValues = append(facet.TopValues, TagValue{
+			Value:      row.Value,
+			Count:      row.Count,
+			Percentage: percentage,
+			FirstSeen:  row.FirstSeen,
+			LastSeen:   row.LastSeen,
+		})
+	}
+	return facets
+}
@@ -0,0 +1,320 @@
+package issues
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/santoshkpatro/unbit/internal/access"
+	"github.com/santoshkpatro/unbit/internal/models"
+	"github.com/santoshkpatro/unbit/internal/query"
+)
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+)
+
+type issueSort struct {
+	column string
+	cast   string
+}
+
+// issueSorts maps the sort names accepted by the search endpoint to the
+// column they order by and the type cursor values are compared as.
+var issueSorts = map[string]issueSort{
+	"last_seen":   {"i.last_seen_at", "timestamptz"},
+	"first_seen":  {"i.first_seen_at", "timestamptz"},
+	"event_count": {"i.event_count", "bigint"},
+	"user_count":  {"i.user_count", "bigint"},
+}
+
+var issueStatuses = map[string]bool{
+	models.IssueUnresolved: true,
+	models.IssueResolved:   true,
+	models.IssueIgnored:    true,
+}
+
+// issueQuerySchema is what the q parameter of the issue search filters on.
+// Keys it doesn't know, such as runtime.name, match issues having at least one
+// event with that property.
+var issueQuerySchema = &query.Schema{
+	Fields: map[string]query.Field{
+		"status":        {Column: "i.status"},
+		"level":         {Column: "i.level"},
+		"type":          {Column: "i.type"},
+		"message":       {Column: "i.message", Kind: query.KindContains},
+		"fingerprint":   {Column: "i.fingerprint"},
+		"project":       {Column: "i.project_id"},
+		"assigned":      {Column: "i.assignee_id", Kind: query.KindUser},
+		"events":        {Column: "i.event_count", Kind: query.KindNumber},
+		"users":         {Column: "i.user_count", Kind: query.KindNumber},
+		"first_seen":    {Column: "i.first_seen_at", Kind: query.KindTime},
+		"last_seen":     {Column: "i.last_seen_at", Kind: query.KindTime},
+		"first_release": {Column: "i.first_release"},
+		"last_release":  {Column: "i.last_release"},
+		"environment": {
+			Column: "e.environment",
+			Wrap:   "EXISTS (SELECT 1 FROM events e WHERE e.issue_id = i.id AND %s)",
+		},
+	},
+	FreeText: query.Field{Column: "i.message"},
+	Is: map[string]string{
+		models.IssueUnresolved: "i.status = 'unresolved'",
+		models.IssueResolved:   "i.status = 'resolved'",
+		models.IssueIgnored:    "i.status = 'ignored'",
+		"assigned":             "i.assignee_id IS NOT NULL",
+		"unassigned":           "i.assignee_id IS NULL",
+		"regression":           "i.is_regression",
+	},
+	Tags: &query.Field{
+		Column: "(e.properties -> 'tags')",
+		Wrap:   "EXISTS (SELECT 1 FROM events e WHERE e.issue_id = i.id AND %s)",
+	},
+	Property: query.JSONProperty("e.properties", "EXISTS (SELECT 1 FROM events e WHERE e.issue_id = i.id AND %s)"),
+}
+
+// eventQuerySchema is what the q parameter of event lists filters on. Keys
+// it doesn't know are read from the event properties.
+var eventQuerySchema = &query.Schema{
+	Fields: map[string]query.Field{
+		"level":       {Column: "(e.properties ->> 'level')"},
+		"type":        {Column: "(e.properties ->> 'type')"},
+		"message":     {Column: "(e.properties ->> 'message')", Kind: query.KindContains},
+		"fingerprint": {Column: "e.fingerprint"},
+		"timestamp":   {Column: "e.timestamp", Kind: query.KindTime},
+		"environment": {Column: "e.environment"},
+	},
+	FreeText: query.Field{Column: "(e.properties ->> 'message')"},
+	Tags:     &query.Field{Column: "(e.properties -> 'tags')"},
+	Property: query.JSONProperty("e.properties", ""),
+}
+
+// whereClause collects SQL conditions along with their positional parameters.
+type whereClause struct {
+	conds []string
+	args  []interface{}
+}
+
+// arg registers a parameter and returns its placeholder.
+func (w *whereClause) arg(v interface{}) string {
+	w.args = append(w.args, v)
+	return fmt.Sprintf("$%d", len(w.args))
+}
+
+func (w *whereClause) add(cond string) {
+	w.conds = append(w.conds, cond)
+}
+
+// addQuery parses a search box query and adds it as a single condition.
+func (w *whereClause) addQuery(schema *query.Schema, q string, userID string) error {
+	node, err := query.Parse(q)
+	if err != nil || node == nil {
+		return err
+	}
+
+	compiler := &query.Compiler{Schema: schema, Arg: w.arg, UserID: userID}
+	cond, err := compiler.Compile(node)
+	if err != nil {
+		return err
+	}
+	w.add(cond)
+	return nil
+}
+
+func (w *whereClause) String() string {
+	if len(w.conds) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(w.conds, " AND ")
+}
+
+// issueCursor points just past the last issue of a page.
+type issueCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// eventCursor points at the event a page of events continues from.
+type eventCursor struct {
+	Timestamp string `json:"t,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Direction string `json:"d"`
+}
+
+func encodeCursor(cursor interface{}) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, cursor interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return errors.New("invalid cursor")
+	}
+	return nil
+}
+
+// cursorFor builds the cursor that continues after row in the given sort.
+func cursorFor(sort string, row issueSummaryRow) issueCursor {
+	cursor := issueCursor{Sort: sort, ID: row.ID}
+	switch sort {
+	case "first_seen":
+		if row.FirstSeenAt != nil {
+			cursor.Value = row.FirstSeenAt.Format(time.RFC3339Nano)
+		}
+	case "event_count":
+		cursor.Value = strconv.FormatInt(row.EventCount, 10)
+	case "user_count":
+		cursor.Value = strconv.FormatInt(row.UserCount, 10)
+	default:
+		if row.LastSeenAt != nil {
+			cursor.Value = row.LastSeenAt.Format(time.RFC3339Nano)
+		}
+	}
+	return cursor
+}
+
+// issueSearch is a parsed issue search request.
+type issueSearch struct {
+	where *whereClause
+	sort  string
+	limit int
+}
+
+// parseIssueSearch turns the search query parameters into SQL conditions on
+// issues i, restricted to the projects userID can see.
+func parseIssueSearch(c echo.Context, userID string) (issueSearch, error) {
+	w := &whereClause{}
+	w.add("i.project_id IN (" + access.VisibleProjects(w.arg(userID)) + ")")
+
+	if projectID := c.QueryParam("project_id"); projectID != "" {
+		w.add("i.project_id = " + w.arg(projectID))
+	}
+
+	if statuses := splitList(c.QueryParam("status")); len(statuses) > 0 {
+		for _, s := range statuses {
+			if !issueStatuses[s] {
+				return issueSearch{}, fmt.Errorf("unknown status %q", s)
+			}
+		}
+		w.add("i.status = ANY(" + w.arg(pq.Array(statuses)) + ")")
+	}
+	if levels := splitList(c.QueryParam("level")); len(levels) > 0 {
+		w.add("i.level = ANY(" + w.arg(pq.Array(levels)) + ")")
+	}
+	if types := splitList(c.QueryParam("type")); len(types) > 0 {
+		w.add("i.type = ANY(" + w.arg(pq.Array(types)) + ")")
+	}
+
+	if environments := splitList(c.QueryParam("environment")); len(environments) > 0 {
+		w.add("EXISTS (SELECT 1 FROM events e WHERE e.issue_id = i.id AND e.environment = ANY(" + w.arg(pq.Array(environments)) + "))")
+	}
+
+	switch assignee := c.QueryParam("assignee"); assignee {
+	case "":
+	case "me":
+		w.add("i.assignee_id = " + w.arg(userID))
+	case "none":
+		w.add("i.assignee_id IS NULL")
+	default:
+		w.add("i.assignee_id = " + w.arg(assignee))
+	}
+
+	ranges := []struct{ param, cond string }{
+		{"first_seen_from", "i.first_seen_at >= "},
+		{"first_seen_to", "i.first_seen_at < "},
+		{"last_seen_from", "i.last_seen_at >= "},
+		{"last_seen_to", "i.last_seen_at < "},
+	}
+	for _, r := range ranges {
+		value := c.QueryParam(r.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return issueSearch{}, fmt.Errorf("%s must be an RFC 3339 timestamp", r.param)
+		}
+		w.add(r.cond + w.arg(t))
+	}
+
+	if message := c.QueryParam("message"); message != "" {
+		w.add("i.message ILIKE " + w.arg("%"+escapeLike(message)+"%"))
+	}
+
+	if err := w.addQuery(issueQuerySchema, c.QueryParam("q"), userID); err != nil {
+		return issueSearch{}, err
+	}
+
+	search := issueSearch{where: w, sort: c.QueryParam("sort"), limit: defaultSearchLimit}
+	if search.sort == "" {
+		search.sort = "last_seen"
+	}
+	sort, ok := issueSorts[search.sort]
+	if !ok {
+		return issueSearch{}, fmt.Errorf("unknown sort %q", search.sort)
+	}
+
+	limit, err := parseLimit(c, defaultSearchLimit)
+	if err != nil {
+		return issueSearch{}, err
+	}
+	search.limit = limit
+
+	if raw := c.QueryParam("cursor"); raw != "" {
+		var cursor issueCursor
+		if err := decodeCursor(raw, &cursor); err != nil || cursor.ID == "" {
+			return issueSearch{}, errors.New("invalid cursor")
+		}
+		if cursor.Sort != search.sort {
+			return issueSearch{}, errors.New("cursor was issued for a different sort")
+		}
+		w.add(fmt.Sprintf("(%s, i.id) < (%s::%s, %s)", sort.column, w.arg(cursor.Value), sort.cast, w.arg(cursor.ID)))
+	}
+
+	return search, nil
+}
+
+// orderBy is the ORDER BY clause matching the search's keyset.
+func (s issueSearch) orderBy() string {
+	return issueSorts[s.sort].column + " DESC, i.id DESC"
+}
+
+// parseLimit reads the limit query parameter.
+func parseLimit(c echo.Context, fallback int) (int, error) {
+	limit := c.QueryParam("limit")
+	if limit == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxSearchLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit)
+	}
+	return n, nil
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
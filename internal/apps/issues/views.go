@@ -1,15 +1,25 @@
 package issues
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/santoshkpatro/unbit/internal/access"
 	"github.com/santoshkpatro/unbit/internal/utils"
+	"github.com/santoshkpatro/unbit/internal/worker"
 )
 
 func (v *IssueContext) RecentIssueListView(c echo.Context) error {
-	userID, _ := utils.CheckAuthentication(c)
+	userID := access.CurrentUser(c).ID
 	var params []interface{}
 	params = append(params, userID) // $1
 
@@ -22,6 +32,25 @@ func (v *IssueContext) RecentIssueListView(c echo.Context) error {
 		params = append(params, projectID)
 	}
 
+	switch c.QueryParam("assigned") {
+	case "me":
+		extraWhere = append(extraWhere, "i.assignee_id = $1")
+	case "none":
+		extraWhere = append(extraWhere, "i.assignee_id IS NULL")
+	}
+
+	// Scoped to an environment, issues show that environment's latest event
+	// and counts only
+	eventCount := "ri.event_count"
+	eventFilter := ""
+	if environment := c.QueryParam("environment"); environment != "" {
+		params = append(params, environment)
+		n := len(params)
+		extraWhere = append(extraWhere, fmt.Sprintf("e.environment = $%d", n))
+		eventCount = fmt.Sprintf("(SELECT count(*) FROM events ev WHERE ev.issue_id = ri.issue_id AND ev.environment = $%d)", n)
+		eventFilter = fmt.Sprintf("WHERE e.environment = $%d", n)
+	}
+
 	where := ""
 	if len(extraWhere) > 0 {
 		where = " AND (" + strings.Join(extraWhere, " AND ") + ")"
@@ -39,6 +68,7 @@ func (v *IssueContext) RecentIssueListView(c echo.Context) error {
 					e.id AS event_id,
 					e.timestamp,
 					i.status,
+					i.is_regression,
 					i.event_count,
 					i.assignee_id,
 					u.email AS assignee_email,
@@ -57,15 +87,8 @@ func (v *IssueContext) RecentIssueListView(c echo.Context) error {
 					LEFT JOIN users u ON i.assignee_id = u.id
 				WHERE
 					e.event_type = 'issues'
-					AND p.id IN (
-						SELECT
-							project_id
-						FROM
-							project_members
-						WHERE
-							user_id = $1
-					)
-					%s
+					AND p.id IN (`+access.VisibleProjects("$1")+`)
+					%[1]s
 				ORDER BY
 					e.issue_id,
 					e.timestamp DESC
@@ -78,6 +101,7 @@ func (v *IssueContext) RecentIssueListView(c echo.Context) error {
 				FROM
 					events e
 					JOIN recent_issues ri ON ri.issue_id = e.issue_id
+				%[3]s
 			),
 			daily_issue_counts AS (
 				SELECT
@@ -96,9 +120,10 @@ func (v *IssueContext) RecentIssueListView(c echo.Context) error {
 		SELECT
 			ri.issue_id AS id,
 			ri.event_id,
-			ri.event_count,
+			%[2]s AS event_count,
 			ri.timestamp,
 			ri.status,
+			ri.is_regression,
 			ri.message,
 			ri.level,
 			ri.type,
@@ -119,6 +144,7 @@ func (v *IssueContext) RecentIssueListView(c echo.Context) error {
 			ri.event_count,
 			ri.timestamp,
 			ri.status,
+			ri.is_regression,
 			ri.message,
 			ri.level,
 			ri.type,
@@ -131,19 +157,17 @@ func (v *IssueContext) RecentIssueListView(c echo.Context) error {
 			ri.age
 		ORDER BY
 			ri.timestamp DESC;
-	`, where)
+	`, where, eventCount, eventFilter)
 	var rows []issueRow
 	err := v.DB.Select(&rows, query, params...)
 	if err != nil {
-		fmt.Println("err", err)
-		return utils.RespondFail(c, 500, "Failed to fetch issues", err)
+		return respondError(c, "Failed to fetch issues", err)
 	}
 	issues := make([]Issue, len(rows))
 	for i, row := range rows {
 		issue, _err := row.ToIssue()
 		if _err != nil {
-			fmt.Println("Error parsing issue:", _err)
-			return utils.RespondFail(c, 500, "Failed to parse issue data", _err)
+			return respondError(c, "Failed to parse issue data", _err)
 		}
 		issues[i] = issue
 	}
@@ -153,16 +177,49 @@ func (v *IssueContext) RecentIssueListView(c echo.Context) error {
 
 func (v *IssueContext) IssueDetailsView(c echo.Context) error {
 	issueID := c.Param("issue_id")
-	userID, _ := utils.CheckAuthentication(c)
+	userID := access.CurrentUser(c).ID
+	params := []interface{}{userID, issueID}
 
-	query := `
+	// Scoped to an environment, the issue shows that environment's latest
+	// event and counts only. Counts go by $2 rather than i.id so they are
+	// computed once, not for every event row.
+	eventCount := "i.event_count"
+	eventFilter, countFilter := "", ""
+	if environment := c.QueryParam("environment"); environment != "" {
+		params = append(params, environment)
+		eventCount = "(SELECT count(*) FROM events ev WHERE ev.issue_id = $2 AND ev.environment = $3)"
+		eventFilter = "AND e.environment = $3"
+		countFilter = "AND ev.environment = $3"
+	}
+
+	query := fmt.Sprintf(`
 		SELECT DISTINCT
 			ON (e.issue_id) i.id,
 			e.id AS event_id,
 			e.timestamp,
-			i.event_count,
+			%[1]s AS event_count,
+			(
+				SELECT
+					json_agg(json_build_object('date', d.day::date, 'eventCount', (
+						SELECT count(*)
+						FROM events ev
+						WHERE ev.issue_id = $2
+							AND ev.timestamp >= d.day
+							AND ev.timestamp < d.day + interval '1 day'
+							%[2]s
+					)) ORDER BY d.day DESC)
+				FROM
+					generate_series(CURRENT_DATE - interval '13 days', CURRENT_DATE, interval '1 day') AS d(day)
+			) AS issue_count_report,
 			i.assignee_id,
+			i.assigned_by,
+			i.assigned_at,
 			i.status,
+			i.is_regression,
+			i.first_release,
+			i.last_release,
+			COALESCE(e.properties ->> 'release', '') AS release,
+			COALESCE(e.properties ->> 'environment', '') AS environment,
 			u.email AS assignee_email,
 			concat_ws(' ', u.first_name, u.last_name) AS assignee_name,
 			p.id AS project_id,
@@ -176,6 +233,13 @@ func (v *IssueContext) IssueDetailsView(c echo.Context) error {
 			e.properties -> 'process' AS process,
 			e.properties -> 'thread' AS thread,
 			e.properties -> 'host' AS host,
+			e.properties -> 'breadcrumbs' AS breadcrumbs,
+			e.properties -> 'tags' AS tags,
+			e.properties -> 'user' AS "user",
+			e.properties -> 'request' AS request,
+			e.properties -> 'extra' AS extra,
+			e.properties -> 'exceptions' AS exceptions,
+			e.properties -> 'threads' AS threads,
 			floor(
 				extract(
 					epoch
@@ -190,40 +254,46 @@ func (v *IssueContext) IssueDetailsView(c echo.Context) error {
 			LEFT JOIN users u ON i.assignee_id = u.id
 		WHERE
 			e.event_type = 'issues'
-			AND p.id IN (
-				SELECT
-					project_id
-				FROM
-					project_members
-				WHERE
-					user_id = $1
-			)
+			AND p.id IN (`+access.VisibleProjects("$1")+`)
 			AND issue_id = $2
+			%[3]s
 		ORDER BY
 			e.issue_id,
 			e.timestamp DESC
-	`
+	`, eventCount, countFilter, eventFilter)
 	var row issueDetailRow
-	err := v.DB.Get(&row, query, userID, issueID)
+	err := v.DB.Get(&row, query, params...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusNotFound, "Issue not found", nil)
+	}
 	if err != nil {
-		fmt.Println("err", err)
-		return utils.RespondFail(c, 500, "Failed to fetch issue details", err)
+		return respondError(c, "Failed to fetch issue details", err)
 	}
 
 	issue, err := row.ToIssueDetail()
 	if err != nil {
-		return utils.RespondFail(c, 500, "Failed to parse issue details", err)
+		return respondError(c, "Failed to parse issue details", err)
 	}
 
 	return utils.RespondOK(c, issue, "")
 }
 
 func (v *IssueContext) PreviousEventsView(c echo.Context) error {
-	userID, _ := utils.CheckAuthentication(c)
+	userID := access.CurrentUser(c).ID
 	issueID := c.Param("issue_id")
-	limit := 5
+	limit, err := parseLimit(c, 5)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid limit", err.Error())
+	}
 
-	query := `
+	w := &whereClause{}
+	w.add("e.issue_id = " + w.arg(issueID))
+	w.add("e.project_id IN (" + access.VisibleProjects(w.arg(userID)) + ")")
+	if err := listFilter(w, c.QueryParam("q"), userID); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid query", err.Error())
+	}
+
+	query := fmt.Sprintf(`
 		SELECT
 			e.id,
 			e.timestamp,
@@ -234,26 +304,969 @@ func (v *IssueContext) PreviousEventsView(c echo.Context) error {
 		FROM
 			events e
 		WHERE
-			e.issue_id = $1
-			AND e.event_type = 'issues' AND
-			e.project_id IN (
-				SELECT
-					project_id
-				FROM
-					project_members
-				WHERE
-					user_id = $2
-			)
+			%s
 		ORDER BY
 			e.timestamp DESC
-		LIMIT $3
-	`
+		LIMIT %d
+	`, w, limit)
 	var rows []eventRow
-	err := v.DB.Select(&rows, query, issueID, userID, limit)
+	err = v.DB.Select(&rows, query, w.args...)
 	if err != nil {
-		fmt.Println("err", err)
-		return utils.RespondFail(c, 500, "Failed to fetch previous events", err)
+		return respondError(c, "Failed to fetch previous events", err)
 	}
 
 	return utils.RespondOK(c, rows, "")
 }
+
+// lockIssue checks that the user may perm in the issue's project, then loads
+// the issue and locks it for the rest of tx.
+func lockIssue(c echo.Context, tx *sqlx.Tx, issueID string, perm access.Permission) (issueRef, error) {
+	var issue issueRef
+	if _, err := access.AuthorizeIssue(c, tx, issueID, perm); err != nil {
+		return issue, err
+	}
+
+	err := tx.Get(&issue, `
+		SELECT
+			i.id,
+			i.project_id,
+			i.fingerprint
+		FROM
+			issues i
+		WHERE
+			i.id = $1
+		FOR UPDATE
+	`, issueID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return issue, access.ErrNotFound
+	}
+	return issue, err
+}
+
+// refreshIssueSummary recomputes the first/last seen times and releases,
+// latest level, type and message, affected users and tag rollup of issues
+// whose events were moved around.
+func refreshIssueSummary(tx *sqlx.Tx, issueIDs ...string) error {
+	_, err := tx.Exec(`
+		UPDATE issues i
+		SET first_seen_at = s.first_seen_at,
+			last_seen_at = s.last_seen_at,
+			level = s.level,
+			type = s.type,
+			message = s.message,
+			first_release = s.first_release,
+			last_release = s.last_release
+		FROM (
+			SELECT
+				issue_id,
+				MIN(timestamp) AS first_seen_at,
+				MAX(timestamp) AS last_seen_at,
+				(array_agg(properties ->> 'level' ORDER BY timestamp DESC))[1] AS level,
+				(array_agg(properties ->> 'type' ORDER BY timestamp DESC))[1] AS type,
+				(array_agg(properties ->> 'message' ORDER BY timestamp DESC))[1] AS message,
+				(array_agg(properties ->> 'release' ORDER BY timestamp) FILTER (WHERE properties ->> 'release' <> ''))[1] AS first_release,
+				(array_agg(properties ->> 'release' ORDER BY timestamp DESC) FILTER (WHERE properties ->> 'release' <> ''))[1] AS last_release
+			FROM events
+			WHERE issue_id = ANY($1)
+			GROUP BY issue_id
+		) s
+		WHERE i.id = s.issue_id
+	`, pq.Array(issueIDs))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM issue_users WHERE issue_id = ANY($1)`, pq.Array(issueIDs)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO issue_users (issue_id, user_key)
+		SELECT DISTINCT issue_id, user_key
+		FROM (
+			SELECT issue_id, `+worker.UserKeySQL+` AS user_key
+			FROM events
+			WHERE issue_id = ANY($1)
+		) u
+		WHERE user_key IS NOT NULL
+	`, pq.Array(issueIDs)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE issues i
+		SET user_count = (SELECT count(*) FROM issue_users u WHERE u.issue_id = i.id)
+		WHERE i.id = ANY($1)
+	`, pq.Array(issueIDs)); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM issue_tag_values WHERE issue_id = ANY($1)`, pq.Array(issueIDs)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO issue_tag_values (issue_id, key, value, count, first_seen, last_seen)
+	`+worker.TagValuesSQL, pq.Array(issueIDs))
+	return err
+}
+
+func (v *IssueContext) MergeIssuesView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	issueID := c.Param("issue_id")
+
+	var data issueMergeData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	sourceIDs := make([]string, 0, len(data.IssueIDs))
+	seen := map[string]bool{issueID: true}
+	for _, id := range data.IssueIDs {
+		if !seen[id] {
+			seen[id] = true
+			sourceIDs = append(sourceIDs, id)
+		}
+	}
+	if len(sourceIDs) == 0 {
+		return utils.RespondFail(c, http.StatusBadRequest, "Nothing to merge", nil)
+	}
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return respondError(c, "Database error", err)
+	}
+	defer tx.Rollback()
+
+	target, err := lockIssue(c, tx, issueID, access.MergeIssues)
+	if err != nil {
+		return access.RespondDenied(c, err, "Issue not found")
+	}
+
+	var sources []issueRef
+	err = tx.Select(&sources, `
+		SELECT id, project_id, fingerprint
+		FROM issues
+		WHERE id = ANY($1) AND project_id = $2
+		ORDER BY id
+		FOR UPDATE
+	`, pq.Array(sourceIDs), target.ProjectID)
+	if err != nil {
+		return respondError(c, "Failed to fetch issues", err)
+	}
+	if len(sources) != len(sourceIDs) {
+		return utils.RespondFail(c, http.StatusBadRequest, "Issues must exist and belong to the same project", nil)
+	}
+
+	// Remember which fingerprint each event came from, so it can be split out again
+	if _, err := tx.Exec(`
+		UPDATE events e
+		SET issue_id = $1, fingerprint = COALESCE(e.fingerprint, i.fingerprint), updated_at = NOW()
+		FROM issues i
+		WHERE e.issue_id = i.id AND i.id = ANY($2)
+	`, target.ID, pq.Array(sourceIDs)); err != nil {
+		return respondError(c, "Failed to move events", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE events SET fingerprint = $2 WHERE issue_id = $1 AND fingerprint IS NULL
+	`, target.ID, target.Fingerprint); err != nil {
+		return respondError(c, "Failed to move events", err)
+	}
+
+	// Future events with the merged fingerprints land in the target issue
+	if _, err := tx.Exec(`
+		UPDATE issue_aliases SET issue_id = $1 WHERE issue_id = ANY($2)
+	`, target.ID, pq.Array(sourceIDs)); err != nil {
+		return respondError(c, "Failed to record aliases", err)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO issue_aliases (project_id, fingerprint, issue_id)
+		SELECT project_id, fingerprint, $1
+		FROM issues
+		WHERE id = ANY($2)
+		ON CONFLICT (project_id, fingerprint) DO UPDATE SET issue_id = EXCLUDED.issue_id
+	`, target.ID, pq.Array(sourceIDs)); err != nil {
+		return respondError(c, "Failed to record aliases", err)
+	}
+
+	var eventCount int
+	if err := tx.Get(&eventCount, `
+		UPDATE issues
+		SET event_count = event_count + (SELECT COALESCE(SUM(event_count), 0) FROM issues WHERE id = ANY($2)),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING event_count
+	`, target.ID, pq.Array(sourceIDs)); err != nil {
+		return respondError(c, "Failed to update issue", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM issues WHERE id = ANY($1)`, pq.Array(sourceIDs)); err != nil {
+		return respondError(c, "Failed to remove merged issues", err)
+	}
+	if err := refreshIssueSummary(tx, target.ID); err != nil {
+		return respondError(c, "Failed to update issue", err)
+	}
+
+	if err := recordActivity(tx, target, userID, "merged", map[string]interface{}{
+		"issueIds": sourceIDs,
+	}); err != nil {
+		return respondError(c, "Failed to record activity", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return respondError(c, "Failed to merge issues", err)
+	}
+
+	return utils.RespondOK(c, map[string]interface{}{
+		"id":             target.ID,
+		"mergedIssueIds": sourceIDs,
+		"eventCount":     eventCount,
+	}, "Issues merged successfully")
+}
+
+func (v *IssueContext) UnmergeIssueView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	issueID := c.Param("issue_id")
+
+	var data issueUnmergeData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return respondError(c, "Database error", err)
+	}
+	defer tx.Rollback()
+
+	issue, err := lockIssue(c, tx, issueID, access.MergeIssues)
+	if err != nil {
+		return access.RespondDenied(c, err, "Issue not found")
+	}
+	if data.Fingerprint == issue.Fingerprint {
+		return utils.RespondFail(c, http.StatusBadRequest, "Cannot split out the issue's own fingerprint", nil)
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM issue_aliases WHERE project_id = $1 AND fingerprint = $2 AND issue_id = $3
+	`, issue.ProjectID, data.Fingerprint, issue.ID); err != nil {
+		return respondError(c, "Failed to remove alias", err)
+	}
+
+	newIssueID := utils.GenerateID("isu")
+	result, err := tx.Exec(`
+		INSERT INTO issues (id, project_id, fingerprint, status, event_count)
+		VALUES ($1, $2, $3, 'unresolved', 0)
+		ON CONFLICT (project_id, fingerprint) DO NOTHING
+	`, newIssueID, issue.ProjectID, data.Fingerprint)
+	if err != nil {
+		return respondError(c, "Failed to create issue", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return utils.RespondFail(c, http.StatusConflict, "Another issue already uses this fingerprint", nil)
+	}
+
+	result, err = tx.Exec(`
+		UPDATE events SET issue_id = $1, updated_at = NOW() WHERE issue_id = $2 AND fingerprint = $3
+	`, newIssueID, issue.ID, data.Fingerprint)
+	if err != nil {
+		return respondError(c, "Failed to move events", err)
+	}
+	moved, _ := result.RowsAffected()
+	if moved == 0 {
+		return utils.RespondFail(c, http.StatusNotFound, "No events with this fingerprint", nil)
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE issues
+		SET event_count = $2, created_at = (SELECT MIN(timestamp) FROM events WHERE issue_id = $1)
+		WHERE id = $1
+	`, newIssueID, moved); err != nil {
+		return respondError(c, "Failed to update issue", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE issues SET event_count = GREATEST(event_count - $2, 0), updated_at = NOW() WHERE id = $1
+	`, issue.ID, moved); err != nil {
+		return respondError(c, "Failed to update issue", err)
+	}
+	if err := refreshIssueSummary(tx, issue.ID, newIssueID); err != nil {
+		return respondError(c, "Failed to update issue", err)
+	}
+
+	if err := recordActivity(tx, issue, userID, "unmerged", map[string]interface{}{
+		"fingerprint": data.Fingerprint,
+		"issueId":     newIssueID,
+	}); err != nil {
+		return respondError(c, "Failed to record activity", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return respondError(c, "Failed to unmerge issue", err)
+	}
+
+	return utils.RespondOK(c, map[string]interface{}{
+		"id":         newIssueID,
+		"eventCount": moved,
+	}, "Issue unmerged successfully")
+}
+
+func (v *IssueContext) IssueFingerprintListView(c echo.Context) error {
+	issueID := c.Param("issue_id")
+	if _, err := access.AuthorizeIssue(c, v.DB, issueID, access.ViewProject); err != nil {
+		return access.RespondDenied(c, err, "Issue not found")
+	}
+
+	query := `
+		SELECT
+			COALESCE(e.fingerprint, i.fingerprint) AS fingerprint,
+			count(*) AS event_count,
+			max(e.timestamp) AS last_seen,
+			COALESCE(e.fingerprint, i.fingerprint) = i.fingerprint AS is_primary
+		FROM
+			events e
+			JOIN issues i ON i.id = e.issue_id
+		WHERE
+			e.issue_id = $1
+		GROUP BY
+			COALESCE(e.fingerprint, i.fingerprint),
+			i.fingerprint
+		ORDER BY
+			event_count DESC
+	`
+	rows := []IssueFingerprint{}
+	err := v.DB.Select(&rows, query, issueID)
+	if err != nil {
+		return respondError(c, "Failed to fetch fingerprints", err)
+	}
+
+	return utils.RespondOK(c, rows, "")
+}
+
+// recordActivity appends an entry to the issue's activity log.
+func recordActivity(tx *sqlx.Tx, issue issueRef, userID string, kind string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO issue_activities (id, issue_id, project_id, user_id, kind, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, utils.GenerateID("act"), issue.ID, issue.ProjectID, userID, kind, payload)
+	return err
+}
+
+// changeIssueStatus runs update against the locked issue and logs the change
+// under kind, all in one transaction.
+func (v *IssueContext) changeIssueStatus(c echo.Context, kind string, data map[string]interface{}, update string, args ...interface{}) error {
+	userID := access.CurrentUser(c).ID
+	issueID := c.Param("issue_id")
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return respondError(c, "Database error", err)
+	}
+	defer tx.Rollback()
+
+	issue, err := lockIssue(c, tx, issueID, access.ResolveIssues)
+	if err != nil {
+		return access.RespondDenied(c, err, "Issue not found")
+	}
+
+	var status IssueStatus
+	if err := tx.Get(&status, update, append([]interface{}{issue.ID}, args...)...); err != nil {
+		return respondError(c, "Failed to update issue", err)
+	}
+
+	if err := recordActivity(tx, issue, userID, kind, data); err != nil {
+		return respondError(c, "Failed to record activity", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return respondError(c, "Failed to update issue", err)
+	}
+
+	return utils.RespondOK(c, status, "Issue "+kind)
+}
+
+func (v *IssueContext) ResolveIssueView(c echo.Context) error {
+	return v.changeIssueStatus(c, "resolved", nil, `
+		UPDATE issues
+		SET status = 'resolved',
+			resolved_at = NOW(),
+			ignored_until = NULL,
+			ignored_until_count = NULL,
+			is_regression = FALSE,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, status, resolved_at, ignored_until, ignored_until_count, is_regression
+	`)
+}
+
+// IgnoreIssueView ignores an issue forever, for durationMinutes, or until
+// count more events arrive, whichever is given first.
+func (v *IssueContext) IgnoreIssueView(c echo.Context) error {
+	var data issueIgnoreData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	var until *time.Time
+	if data.DurationMinutes != nil {
+		t := time.Now().Add(time.Duration(*data.DurationMinutes) * time.Minute)
+		until = &t
+	}
+
+	return v.changeIssueStatus(c, "ignored", map[string]interface{}{
+		"durationMinutes": data.DurationMinutes,
+		"count":           data.Count,
+	}, `
+		UPDATE issues
+		SET status = 'ignored',
+			resolved_at = NULL,
+			ignored_until = $2,
+			ignored_until_count = event_count + $3,
+			is_regression = FALSE,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, status, resolved_at, ignored_until, ignored_until_count, is_regression
+	`, until, data.Count)
+}
+
+func (v *IssueContext) ReopenIssueView(c echo.Context) error {
+	return v.changeIssueStatus(c, "reopened", nil, `
+		UPDATE issues
+		SET status = 'unresolved',
+			resolved_at = NULL,
+			ignored_until = NULL,
+			ignored_until_count = NULL,
+			is_regression = FALSE,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, status, resolved_at, ignored_until, ignored_until_count, is_regression
+	`)
+}
+
+func (v *IssueContext) IssueActivityListView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	issueID := c.Param("issue_id")
+
+	query := `
+		SELECT
+			a.id,
+			a.kind,
+			a.data,
+			a.user_id,
+			concat_ws(' ', u.first_name, u.last_name) AS user_name,
+			u.email AS user_email,
+			a.created_at
+		FROM
+			issue_activities a
+			LEFT JOIN users u ON a.user_id = u.id
+		WHERE
+			a.issue_id = $1
+			AND a.project_id IN (` + access.VisibleProjects("$2") + `)
+		ORDER BY
+			a.created_at DESC
+	`
+	var rows []activityRow
+	err := v.DB.Select(&rows, query, issueID, userID)
+	if err != nil {
+		return respondError(c, "Failed to fetch activity", err)
+	}
+
+	activities := make([]Activity, len(rows))
+	for i, row := range rows {
+		activities[i] = row.ToActivity()
+	}
+
+	return utils.RespondOK(c, activities, "")
+}
+
+func (v *IssueContext) AssignIssueView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	issueID := c.Param("issue_id")
+
+	var data issueAssignData
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return respondError(c, "Database error", err)
+	}
+	defer tx.Rollback()
+
+	issue, err := lockIssue(c, tx, issueID, access.AssignIssues)
+	if err != nil {
+		return access.RespondDenied(c, err, "Issue not found")
+	}
+
+	var isMember bool
+	err = tx.Get(&isMember, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM project_members pm
+			JOIN users u ON u.id = pm.user_id
+			WHERE pm.project_id = $1 AND pm.user_id = $2 AND u.is_active = TRUE
+		)
+	`, issue.ProjectID, data.UserID)
+	if err != nil {
+		return respondError(c, "Database error", err)
+	}
+	if !isMember {
+		return utils.RespondFail(c, http.StatusBadRequest, "User is not a member of this project", nil)
+	}
+
+	var assignment IssueAssignment
+	err = tx.Get(&assignment, `
+		UPDATE issues
+		SET assignee_id = $2, assigned_by = $3, assigned_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, assignee_id, assigned_by, assigned_at
+	`, issue.ID, data.UserID, userID)
+	if err != nil {
+		return respondError(c, "Failed to assign issue", err)
+	}
+
+	if err := recordActivity(tx, issue, userID, "assigned", map[string]interface{}{
+		"assigneeId": data.UserID,
+	}); err != nil {
+		return respondError(c, "Failed to record activity", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return respondError(c, "Failed to assign issue", err)
+	}
+
+	return utils.RespondOK(c, assignment, "Issue assigned")
+}
+
+func (v *IssueContext) UnassignIssueView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	issueID := c.Param("issue_id")
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return respondError(c, "Database error", err)
+	}
+	defer tx.Rollback()
+
+	issue, err := lockIssue(c, tx, issueID, access.AssignIssues)
+	if err != nil {
+		return access.RespondDenied(c, err, "Issue not found")
+	}
+
+	var previous *string
+	if err := tx.Get(&previous, `SELECT assignee_id FROM issues WHERE id = $1`, issue.ID); err != nil {
+		return respondError(c, "Database error", err)
+	}
+
+	var assignment IssueAssignment
+	err = tx.Get(&assignment, `
+		UPDATE issues
+		SET assignee_id = NULL, assigned_by = $2, assigned_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, assignee_id, assigned_by, assigned_at
+	`, issue.ID, userID)
+	if err != nil {
+		return respondError(c, "Failed to unassign issue", err)
+	}
+
+	if err := recordActivity(tx, issue, userID, "unassigned", map[string]interface{}{
+		"previousAssigneeId": previous,
+	}); err != nil {
+		return respondError(c, "Failed to record activity", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return respondError(c, "Failed to unassign issue", err)
+	}
+
+	return utils.RespondOK(c, assignment, "Issue unassigned")
+}
+
+func (v *IssueContext) IssueSearchView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+
+	search, err := parseIssueSearch(c, userID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid search", err.Error())
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			i.id,
+			i.status,
+			i.is_regression,
+			i.level,
+			i.type,
+			i.message,
+			i.event_count,
+			i.user_count,
+			i.first_seen_at,
+			i.last_seen_at,
+			i.first_release,
+			i.last_release,
+			i.assignee_id,
+			concat_ws(' ', u.first_name, u.last_name) AS assignee_name,
+			u.email AS assignee_email,
+			p.id AS project_id,
+			p.name AS project_name
+		FROM
+			issues i
+			JOIN projects p ON p.id = i.project_id
+			LEFT JOIN users u ON i.assignee_id = u.id
+		WHERE
+			%s
+		ORDER BY
+			%s
+		LIMIT %d
+	`, search.where, search.orderBy(), search.limit+1)
+
+	var rows []issueSummaryRow
+	if err := v.DB.Select(&rows, query, search.where.args...); err != nil {
+		return respondError(c, "Failed to search issues", err)
+	}
+
+	page := IssuePage{Issues: make([]IssueSummary, 0, len(rows))}
+	if len(rows) > search.limit {
+		rows = rows[:search.limit]
+		page.NextCursor = encodeCursor(cursorFor(search.sort, rows[len(rows)-1]))
+	}
+	for _, row := range rows {
+		page.Issues = append(page.Issues, row.ToIssueSummary())
+	}
+
+	return utils.RespondOK(c, page, "")
+}
+
+// eventDetailQuery loads one event, aliased cur, with the ids of its
+// neighbours among the events of its issue matching the list filter on e.
+// Neighbours follow the event list, newest first: next is the older event
+// and previous the newer one, like the list's cursor links.
+const eventDetailQuery = `
+	SELECT
+		cur.id,
+		cur.issue_id,
+		cur.project_id,
+		cur.timestamp,
+		cur.fingerprint,
+		cur.properties,
+		cur.created_at,
+		(
+			SELECT e.id FROM events e
+			WHERE e.issue_id = cur.issue_id AND %[1]s AND (e.timestamp, e.id) > (cur.timestamp, cur.id)
+			ORDER BY e.timestamp, e.id
+			LIMIT 1
+		) AS previous_event_id,
+		(
+			SELECT e.id FROM events e
+			WHERE e.issue_id = cur.issue_id AND %[1]s AND (e.timestamp, e.id) < (cur.timestamp, cur.id)
+			ORDER BY e.timestamp DESC, e.id DESC
+			LIMIT 1
+		) AS next_event_id,
+		(
+			SELECT e.id FROM events e
+			WHERE e.issue_id = cur.issue_id AND %[1]s
+			ORDER BY e.timestamp, e.id
+			LIMIT 1
+		) AS oldest_event_id,
+		(
+			SELECT e.id FROM events e
+			WHERE e.issue_id = cur.issue_id AND %[1]s
+			ORDER BY e.timestamp DESC, e.id DESC
+			LIMIT 1
+		) AS latest_event_id
+	FROM
+		events cur
+	WHERE
+		%[2]s
+`
+
+// listFilter adds the conditions of the event list, apart from the issue,
+// to w. Event details navigate within the same events.
+func listFilter(w *whereClause, q string, userID string) error {
+	w.add("e.event_type = 'issues'")
+	return w.addQuery(eventQuerySchema, q, userID)
+}
+
+// respondEvent sends the event matching w with its neighbours among the
+// events matching filter, both sharing the parameters of w.
+func (v *IssueContext) respondEvent(c echo.Context, w *whereClause, filter string) error {
+	var row eventDetailRow
+	err := v.DB.Get(&row, fmt.Sprintf(eventDetailQuery, filter, w), w.args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusNotFound, "Event not found", nil)
+	}
+	if err != nil {
+		return respondError(c, "Failed to fetch event", err)
+	}
+
+	return utils.RespondOK(c, row.ToEventDetail(), "")
+}
+
+// EventDetailView returns an event. Its navigation honours the q parameter
+// of the event list it was opened from.
+func (v *IssueContext) EventDetailView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+
+	w := &whereClause{}
+	if err := listFilter(w, c.QueryParam("q"), userID); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid query", err.Error())
+	}
+	filter := w.String()
+	w.conds = nil
+
+	w.add("cur.id = " + w.arg(c.Param("event_id")))
+	w.add("cur.project_id IN (" + access.VisibleProjects(w.arg(userID)) + ")")
+
+	return v.respondEvent(c, w, filter)
+}
+
+// IssueEventView returns one event of an issue, where the event id may also
+// be "latest" or "oldest" of the events the list shows for the q parameter.
+func (v *IssueContext) IssueEventView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	eventID := c.Param("event_id")
+
+	w := &whereClause{}
+	if err := listFilter(w, c.QueryParam("q"), userID); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid query", err.Error())
+	}
+	filter := w.String()
+	w.conds = nil
+
+	issueID := w.arg(c.Param("issue_id"))
+	w.add("cur.issue_id = " + issueID)
+	w.add("cur.project_id IN (" + access.VisibleProjects(w.arg(userID)) + ")")
+
+	endpoint := func(order string) string {
+		return `cur.id = (
+			SELECT e.id FROM events e
+			WHERE e.issue_id = ` + issueID + ` AND ` + filter + `
+			ORDER BY ` + order + `
+			LIMIT 1
+		)`
+	}
+	switch eventID {
+	case "latest":
+		w.add(endpoint("e.timestamp DESC, e.id DESC"))
+	case "oldest":
+		w.add(endpoint("e.timestamp, e.id"))
+	default:
+		w.add("cur.id = " + w.arg(eventID))
+	}
+
+	return v.respondEvent(c, w, filter)
+}
+
+// IssueEventListView pages through the events of an issue, newest first.
+// Cursors carry the event a page continues from and the direction to go.
+func (v *IssueContext) IssueEventListView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	issueID := c.Param("issue_id")
+
+	limit, err := parseLimit(c, defaultSearchLimit)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid limit", err.Error())
+	}
+
+	var cursor eventCursor
+	if raw := c.QueryParam("cursor"); raw != "" {
+		if err := decodeCursor(raw, &cursor); err != nil {
+			return utils.RespondFail(c, http.StatusBadRequest, "Invalid cursor", err.Error())
+		}
+	}
+
+	w := &whereClause{}
+	w.add("e.issue_id = " + w.arg(issueID))
+	w.add("e.event_type = 'issues'")
+	w.add("e.project_id IN (" + access.VisibleProjects(w.arg(userID)) + ")")
+	if err := w.addQuery(eventQuerySchema, c.QueryParam("q"), userID); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid query", err.Error())
+	}
+
+	// Pages going towards newer events are read oldest first and reversed
+	ascending := false
+	switch cursor.Direction {
+	case "":
+	case "next", "prev":
+		if _, err := time.Parse(time.RFC3339Nano, cursor.Timestamp); err != nil || cursor.ID == "" {
+			return utils.RespondFail(c, http.StatusBadRequest, "Invalid cursor", nil)
+		}
+		cmp := "<"
+		if cursor.Direction == "prev" {
+			cmp, ascending = ">", true
+		}
+		w.add(fmt.Sprintf("(e.timestamp, e.id) %s (%s::timestamptz, %s)", cmp, w.arg(cursor.Timestamp), w.arg(cursor.ID)))
+	case "oldest":
+		ascending = true
+	default:
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid cursor", nil)
+	}
+
+	order := "e.timestamp DESC, e.id DESC"
+	if ascending {
+		order = "e.timestamp, e.id"
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			e.id,
+			e.timestamp,
+			e.properties ->> 'message' AS message,
+			e.properties ->> 'type' AS type,
+			e.properties ->> 'level' AS level,
+			e.created_at
+		FROM
+			events e
+		WHERE
+			%s
+		ORDER BY
+			%s
+		LIMIT %d
+	`, w, order, limit+1)
+
+	var rows []eventRow
+	if err := v.DB.Select(&rows, query, w.args...); err != nil {
+		return respondError(c, "Failed to fetch events", err)
+	}
+
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	if ascending {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	// Whether there are older and newer events than this page
+	hasOlder, hasNewer := more, cursor.Direction == "next"
+	if ascending {
+		hasOlder, hasNewer = cursor.Direction == "prev", more
+	}
+
+	page := EventPage{
+		Events: rows,
+		Links: EventLinks{
+			Latest: pageLink(c, ""),
+			Oldest: pageLink(c, encodeCursor(eventCursor{Direction: "oldest"})),
+		},
+	}
+	if page.Events == nil {
+		page.Events = []eventRow{}
+	}
+	if len(rows) > 0 && hasOlder {
+		last := rows[len(rows)-1]
+		link := pageLink(c, encodeCursor(eventCursor{last.Timestamp.Format(time.RFC3339Nano), last.ID, "next"}))
+		page.Links.Next = &link
+	}
+	if len(rows) > 0 && hasNewer {
+		first := rows[0]
+		link := pageLink(c, encodeCursor(eventCursor{first.Timestamp.Format(time.RFC3339Nano), first.ID, "prev"}))
+		page.Links.Previous = &link
+	}
+
+	return utils.RespondOK(c, page, "")
+}
+
+// pageLink is the current URL with its cursor replaced.
+func pageLink(c echo.Context, cursor string) string {
+	params := url.Values{}
+	for k, vs := range c.QueryParams() {
+		params[k] = vs
+	}
+	params.Del("cursor")
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	link := c.Request().URL.Path
+	if encoded := params.Encode(); encoded != "" {
+		link += "?" + encoded
+	}
+	return link
+}
+
+// IssueTagListView returns, for each tag of an issue, its most common values
+// and their share of the events carrying that tag.
+func (v *IssueContext) IssueTagListView(c echo.Context) error {
+	userID := access.CurrentUser(c).ID
+	issueID := c.Param("issue_id")
+
+	limit, err := parseLimit(c, 10)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid limit", err.Error())
+	}
+
+	w := &whereClause{}
+	w.add("t.issue_id = " + w.arg(issueID))
+	w.add("i.project_id IN (" + access.VisibleProjects(w.arg(userID)) + ")")
+	if key := c.QueryParam("key"); key != "" {
+		w.add("t.key = " + w.arg(key))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			key,
+			value,
+			count,
+			first_seen,
+			last_seen,
+			total,
+			unique_values
+		FROM
+			(
+				SELECT
+					t.key,
+					t.value,
+					t.count,
+					t.first_seen,
+					t.last_seen,
+					(sum(t.count) OVER k)::bigint AS total,
+					count(*) OVER k AS unique_values,
+					row_number() OVER (PARTITION BY t.key ORDER BY t.count DESC, t.value) AS rank
+				FROM
+					issue_tag_values t
+					JOIN issues i ON i.id = t.issue_id
+				WHERE
+					%s
+				WINDOW k AS (PARTITION BY t.key)
+			) r
+		WHERE
+			rank <= %d
+		ORDER BY
+			key,
+			count DESC,
+			value
+	`, w, limit)
+
+	var rows []tagValueRow
+	if err := v.DB.Select(&rows, query, w.args...); err != nil {
+		return respondError(c, "Failed to fetch tags", err)
+	}
+
+	return utils.RespondOK(c, toTagFacets(rows), "")
+}
+
+// respondError logs a failure server side and answers with message alone, so
+// database details don't reach clients.
+func respondError(c echo.Context, message string, err error) error {
+	c.Logger().Errorf("%s: %v", message, err)
+	return utils.RespondFail(c, http.StatusInternalServerError, message, nil)
+}
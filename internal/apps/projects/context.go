@@ -3,9 +3,13 @@ package projects
 import (
 	"github.com/jmoiron/sqlx"
 	"github.com/redis/go-redis/v9"
+	"github.com/santoshkpatro/unbit/internal/access"
+	"github.com/santoshkpatro/unbit/internal/mailer"
 )
 
 type ProjectContext struct {
-	DB    *sqlx.DB
-	Cache *redis.Client
+	DB     *sqlx.DB
+	Cache  *redis.Client
+	Mailer mailer.Mailer
+	Tokens *access.Tokens
 }
@@ -1,16 +1,92 @@
 package projects
 
 type Project struct {
-	ID          string `db:"id" json:"id"`
-	Name        string `db:"name" json:"name"`
-	Description string `db:"description" json:"description"`
-	DsnToken    string `db:"dsn_token" json:"dsnToken"`
-	TotalEvents int64  `db:"total_events" json:"-"`
-	CreatedAt   string `db:"created_at" json:"createdAt"`
-	UpdatedAt   string `db:"updated_at" json:"-"`
+	ID                 string `db:"id" json:"id"`
+	Name               string `db:"name" json:"name"`
+	Description        string `db:"description" json:"description"`
+	DsnToken           string `db:"dsn_token" json:"dsnToken"`
+	DsnEnabled         bool   `db:"dsn_enabled" json:"dsnEnabled"`
+	Grouping           string `db:"grouping_strategy" json:"groupingStrategy"`
+	GroupByEnvironment bool   `db:"group_by_environment" json:"groupByEnvironment"`
+	TotalEvents        int64  `db:"total_events" json:"-"`
+	CreatedAt          string `db:"created_at" json:"createdAt"`
+	UpdatedAt          string `db:"updated_at" json:"-"`
 }
 
 type ProjectNew struct {
 	Name        string `json:"name" validate:"required"`
 	Description string `json:"description"`
 }
+
+type ProjectUpdate struct {
+	Name               *string `json:"name" validate:"omitempty,min=1"`
+	Description        *string `json:"description"`
+	GroupingStrategy   *string `json:"groupingStrategy"`
+	GroupByEnvironment *bool   `json:"groupByEnvironment"`
+}
+
+type ProjectDSNUpdate struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+type GroupingRuleNew struct {
+	Position        int      `json:"position"`
+	TypePattern     string   `json:"typePattern"`
+	MessagePattern  string   `json:"messagePattern"`
+	FilePattern     string   `json:"filePattern"`
+	FunctionPattern string   `json:"functionPattern"`
+	Fingerprint     []string `json:"fingerprint" validate:"required,min=1"`
+}
+
+type Artifact struct {
+	ID        string  `db:"id" json:"id"`
+	ProjectID string  `db:"project_id" json:"projectId"`
+	Release   string  `db:"release" json:"release"`
+	Name      string  `db:"name" json:"name"`
+	Size      int64   `db:"size" json:"size"`
+	Checksum  string  `db:"checksum" json:"checksum"`
+	CreatedBy *string `db:"created_by" json:"createdBy"`
+	CreatedAt string  `db:"created_at" json:"createdAt"`
+	UpdatedAt string  `db:"updated_at" json:"updatedAt"`
+}
+
+type Environment struct {
+	Name       string `db:"name" json:"name"`
+	EventCount int64  `db:"event_count" json:"eventCount"`
+	FirstSeen  string `db:"first_seen" json:"firstSeen"`
+	LastSeen   string `db:"last_seen" json:"lastSeen"`
+}
+
+type Invite struct {
+	ID        string  `db:"id" json:"id"`
+	ProjectID string  `db:"project_id" json:"projectId"`
+	Email     string  `db:"email" json:"email"`
+	Role      string  `db:"role" json:"role"`
+	InvitedBy *string `db:"invited_by" json:"invitedBy"`
+	ExpiresAt string  `db:"expires_at" json:"expiresAt"`
+	CreatedAt string  `db:"created_at" json:"createdAt"`
+}
+
+type InviteNew struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+	Role  string `json:"role" validate:"required"`
+}
+
+type APIToken struct {
+	ID         string  `db:"id" json:"id"`
+	ProjectID  string  `db:"project_id" json:"projectId"`
+	Name       string  `db:"name" json:"name"`
+	CreatedBy  string  `db:"created_by" json:"createdBy"`
+	LastUsedAt *string `db:"last_used_at" json:"lastUsedAt"`
+	CreatedAt  string  `db:"created_at" json:"createdAt"`
+}
+
+type APITokenNew struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// APITokenCreated is the only time the token itself is shown.
+type APITokenCreated struct {
+	APIToken
+	Token string `json:"token"`
+}
@@ -1,21 +1,48 @@
 package projects
 
 import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/santoshkpatro/unbit/internal/access"
+	"github.com/santoshkpatro/unbit/internal/mailer"
+	"github.com/santoshkpatro/unbit/internal/models"
+	"github.com/santoshkpatro/unbit/internal/sourcemap"
 	"github.com/santoshkpatro/unbit/internal/utils"
+	"github.com/santoshkpatro/unbit/internal/worker"
 )
 
+const (
+	maxArtifactSize       = 20 << 20
+	maxArtifactNameLength = 1024
+)
+
+// artifactExtensions are the files the worker symbolicates JavaScript with.
+var artifactExtensions = map[string]bool{
+	".js":  true,
+	".mjs": true,
+	".cjs": true,
+	".map": true,
+}
+
 func (v *ProjectContext) ProjectListView(c echo.Context) error {
-	userID, _ := utils.CheckAuthentication(c)
+	user := access.CurrentUser(c)
 	var projects []Project
 	err := v.DB.Select(&projects, `
 		SELECT p.*
 		FROM projects p
-		JOIN project_members pm ON p.id = pm.project_id
-		WHERE pm.user_id = $1
-	`, userID)
+		WHERE p.id IN (`+access.VisibleProjects("$1")+`)
+	`, user.ID)
 	if err != nil {
 		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch projects", err)
 	}
@@ -24,39 +51,585 @@ func (v *ProjectContext) ProjectListView(c echo.Context) error {
 }
 
 func (v *ProjectContext) ProjectCreateView(c echo.Context) error {
-	userID, _ := utils.CheckAuthentication(c)
+	user := access.CurrentUser(c)
 
 	var newProject ProjectNew
 	if err := c.Bind(&newProject); err != nil {
-		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err)
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&newProject); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	// A project without its owner would be out of everyone's reach
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
 	}
+	defer tx.Rollback()
 
 	var newProjectId = utils.GenerateID("prj")
-	_, err := v.DB.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO projects (id, name, description, dsn_token)
 		VALUES ($1, $2, $3, $4)
 	`, newProjectId, newProject.Name, newProject.Description, utils.GenerateID("dsn"))
 	if err != nil {
-		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create project", err)
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create project", err.Error())
 	}
 
-	_, err = v.DB.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO project_members (id, project_id, user_id, role)
 		VALUES ($1, $2, $3, 'owner')
-	`, utils.GenerateID("prm"), newProjectId, userID)
+	`, utils.GenerateID("prm"), newProjectId, user.ID)
 	if err != nil {
-		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to add project member", err)
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to add project member", err.Error())
 	}
 
 	var createdProject Project
-	err = v.DB.Get(&createdProject, `
+	err = tx.Get(&createdProject, `
 		SELECT *
 		FROM projects
 		WHERE id = $1
 	`, newProjectId)
 	if err != nil {
-		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch created project", err)
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch created project", err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create project", err.Error())
 	}
 
 	return utils.RespondOK(c, createdProject, "Project created successfully")
 }
+
+func (v *ProjectContext) ProjectDSNUpdateView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	var data ProjectDSNUpdate
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	var dsnToken string
+	err := v.DB.Get(&dsnToken, `
+		UPDATE projects
+		SET dsn_enabled = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING dsn_token
+	`, *data.Enabled, projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusNotFound, "Project not found", nil)
+	}
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to update project", err)
+	}
+
+	// Drop the cached lookup so ingest picks up the change right away
+	v.Cache.Del(c.Request().Context(), utils.DSNCachePrefix+dsnToken)
+
+	return utils.RespondOK(c, map[string]interface{}{"dsnEnabled": *data.Enabled}, "Project DSN updated")
+}
+
+func (v *ProjectContext) ProjectUpdateView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	var data ProjectUpdate
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+	if data.GroupingStrategy != nil && !worker.IsFingerprintStrategy(*data.GroupingStrategy) {
+		return utils.RespondFail(c, http.StatusBadRequest, "Unknown grouping strategy", map[string]interface{}{
+			"allowed": worker.FingerprintStrategies(),
+		})
+	}
+
+	var project Project
+	err := v.DB.Get(&project, `
+		UPDATE projects p
+		SET name = COALESCE($1, p.name),
+			description = COALESCE($2, p.description),
+			grouping_strategy = COALESCE($3, p.grouping_strategy),
+			group_by_environment = COALESCE($4, p.group_by_environment),
+			updated_at = NOW()
+		WHERE p.id = $5
+		RETURNING p.*
+	`, data.Name, data.Description, data.GroupingStrategy, data.GroupByEnvironment, projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusNotFound, "Project not found", nil)
+	}
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to update project", err)
+	}
+
+	return utils.RespondOK(c, project, "Project updated successfully")
+}
+
+// EnvironmentListView lists the environments the project has received
+// events from, most recently active first.
+func (v *ProjectContext) EnvironmentListView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ViewProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	environments := []Environment{}
+	err := v.DB.Select(&environments, `
+		SELECT name, event_count, first_seen, last_seen
+		FROM project_environments
+		WHERE project_id = $1
+		ORDER BY last_seen DESC, name
+	`, projectID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch environments", err)
+	}
+
+	return utils.RespondOK(c, environments, "")
+}
+
+func (v *ProjectContext) GroupingRuleListView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ViewProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	rules := []models.GroupingRule{}
+	err := v.DB.Select(&rules, `
+		SELECT *
+		FROM grouping_rules
+		WHERE project_id = $1
+		ORDER BY position, created_at
+	`, projectID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch grouping rules", err)
+	}
+
+	return utils.RespondOK(c, rules, "")
+}
+
+func (v *ProjectContext) GroupingRuleCreateView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	var data GroupingRuleNew
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	rule := models.GroupingRule{
+		ID:              utils.GenerateID("grr"),
+		ProjectID:       projectID,
+		Position:        data.Position,
+		TypePattern:     data.TypePattern,
+		MessagePattern:  data.MessagePattern,
+		FilePattern:     data.FilePattern,
+		FunctionPattern: data.FunctionPattern,
+		Fingerprint:     data.Fingerprint,
+	}
+	if _, err := worker.NewGroupingRule(rule); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid grouping rule", err.Error())
+	}
+
+	var created models.GroupingRule
+	err := v.DB.Get(&created, `
+		INSERT INTO grouping_rules (id, project_id, position, type_pattern, message_pattern, file_pattern, function_pattern, fingerprint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING *
+	`, rule.ID, projectID, rule.Position, rule.TypePattern, rule.MessagePattern,
+		rule.FilePattern, rule.FunctionPattern, rule.Fingerprint)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create grouping rule", err)
+	}
+
+	return utils.RespondOK(c, created, "Grouping rule created successfully")
+}
+
+func (v *ProjectContext) GroupingRuleDeleteView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	ruleID := c.Param("rule_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	result, err := v.DB.Exec(`
+		DELETE FROM grouping_rules
+		WHERE project_id = $1 AND id = $2
+	`, projectID, ruleID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to delete grouping rule", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return utils.RespondFail(c, http.StatusNotFound, "Grouping rule not found", nil)
+	}
+
+	return utils.RespondOK(c, nil, "Grouping rule deleted successfully")
+}
+
+// artifactRelease reads the release an artifact route is scoped to. Artifacts
+// uploaded without one apply to every release of the project.
+func artifactRelease(c echo.Context) (string, error) {
+	return url.PathUnescape(c.Param("release"))
+}
+
+// ArtifactUploadView stores a minified file or source map under the name
+// frames refer to it by, such as https://example.com/static/app.min.js or
+// ~/static/app.min.js to match any host. Uploading a name again replaces it.
+func (v *ProjectContext) ArtifactUploadView(c echo.Context) error {
+	user := access.CurrentUser(c)
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageReleases); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+	release, err := artifactRelease(c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid release", err.Error())
+	}
+
+	// Leave room for the multipart framing around the file
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxArtifactSize+1<<20)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return utils.RespondFail(c, http.StatusRequestEntityTooLarge, "Artifact too large", fmt.Sprintf("must be at most %dMB", maxArtifactSize>>20))
+		}
+		return utils.RespondFail(c, http.StatusBadRequest, "Missing file", err.Error())
+	}
+	if file.Size > maxArtifactSize {
+		return utils.RespondFail(c, http.StatusRequestEntityTooLarge, "Artifact too large", fmt.Sprintf("must be at most %dMB", maxArtifactSize>>20))
+	}
+
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" {
+		name = file.Filename
+	}
+	if name == "" || len(name) > maxArtifactNameLength {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid artifact name", fmt.Sprintf("must be 1 to %d characters", maxArtifactNameLength))
+	}
+	ext := path.Ext(name)
+	if i := strings.IndexAny(ext, "?#"); i >= 0 {
+		ext = ext[:i]
+	}
+	if !artifactExtensions[ext] {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid artifact name", "only .js and .map files are accepted")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Failed to read file", err.Error())
+	}
+	defer src.Close()
+	content, err := io.ReadAll(io.LimitReader(src, maxArtifactSize+1))
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Failed to read file", err.Error())
+	}
+	if len(content) > maxArtifactSize {
+		return utils.RespondFail(c, http.StatusRequestEntityTooLarge, "Artifact too large", fmt.Sprintf("must be at most %dMB", maxArtifactSize>>20))
+	}
+
+	// Reject broken maps now rather than failing silently in the worker
+	if ext == ".map" {
+		if _, err := sourcemap.Parse(content); err != nil {
+			return utils.RespondFail(c, http.StatusBadRequest, "Invalid source map", err.Error())
+		}
+	}
+
+	sum := sha1.Sum(content)
+	var artifact Artifact
+	err = v.DB.Get(&artifact, `
+		INSERT INTO artifacts (id, project_id, release, name, content, size, checksum, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (project_id, release, name) DO UPDATE SET
+			content = EXCLUDED.content,
+			size = EXCLUDED.size,
+			checksum = EXCLUDED.checksum,
+			created_by = EXCLUDED.created_by,
+			updated_at = NOW()
+		RETURNING id, project_id, release, name, size, checksum, created_by, created_at, updated_at
+	`, utils.GenerateID("art"), projectID, release, name, content, len(content), hex.EncodeToString(sum[:]), user.ID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to upload artifact", err)
+	}
+
+	return utils.RespondOK(c, artifact, "Artifact uploaded successfully")
+}
+
+func (v *ProjectContext) ArtifactListView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	release, err := artifactRelease(c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid release", err.Error())
+	}
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ViewProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	artifacts := []Artifact{}
+	err = v.DB.Select(&artifacts, `
+		SELECT id, project_id, release, name, size, checksum, created_by, created_at, updated_at
+		FROM artifacts
+		WHERE project_id = $1 AND release = $2
+		ORDER BY name
+	`, projectID, release)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch artifacts", err)
+	}
+
+	return utils.RespondOK(c, artifacts, "")
+}
+
+func (v *ProjectContext) ArtifactDeleteView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	artifactID := c.Param("artifact_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageReleases); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	result, err := v.DB.Exec(`
+		DELETE FROM artifacts
+		WHERE project_id = $1 AND id = $2
+	`, projectID, artifactID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to delete artifact", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return utils.RespondFail(c, http.StatusNotFound, "Artifact not found", nil)
+	}
+
+	return utils.RespondOK(c, nil, "Artifact deleted successfully")
+}
+
+// InviteCreateView invites someone by email to join the project with a role,
+// replacing any pending invitation of theirs. Owners and admins invite, and
+// only owners invite owners.
+func (v *ProjectContext) InviteCreateView(c echo.Context) error {
+	user := access.CurrentUser(c)
+	projectID := c.Param("project_id")
+
+	var data InviteNew
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+	role := access.Role(data.Role)
+	if !role.Valid() {
+		return utils.RespondFail(c, http.StatusBadRequest, "Unknown role", nil)
+	}
+
+	inviterRole, err := user.ProjectRole(v.DB, projectID)
+	if err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+	if !inviterRole.CanGrant(role) {
+		return utils.RespondFail(c, http.StatusForbidden, "Permission denied", nil)
+	}
+	if !utils.SettingEnabled(v.DB, "feature.inviteUsers", false) {
+		return utils.RespondFail(c, http.StatusForbidden, "Invitations are disabled", nil)
+	}
+
+	email := strings.ToLower(strings.TrimSpace(data.Email))
+	var isMember bool
+	err = v.DB.Get(&isMember, `
+		SELECT EXISTS (
+			SELECT 1 FROM project_members pm JOIN users u ON u.id = pm.user_id
+			WHERE pm.project_id = $1 AND lower(u.email) = $2
+		)
+	`, projectID, email)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	if isMember {
+		return utils.RespondFail(c, http.StatusConflict, "User is already a member of this project", nil)
+	}
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM project_invites WHERE project_id = $1 AND lower(email) = $2 AND accepted_at IS NULL
+	`, projectID, email); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create invitation", err.Error())
+	}
+
+	var invite Invite
+	err = tx.Get(&invite, `
+		INSERT INTO project_invites (id, project_id, email, role, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, project_id, email, role, invited_by, expires_at, created_at
+	`, utils.GenerateID("inv"), projectID, email, role, user.ID, time.Now().Add(access.InviteTTL))
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create invitation", err.Error())
+	}
+
+	var names struct {
+		Project string `db:"project"`
+		Inviter string `db:"inviter"`
+	}
+	err = tx.Get(&names, `
+		SELECT
+			p.name AS project,
+			COALESCE(NULLIF(concat_ws(' ', u.first_name, u.last_name), ''), u.email) AS inviter
+		FROM projects p, users u
+		WHERE p.id = $1 AND u.id = $2
+	`, projectID, user.ID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+
+	token, err := v.Tokens.Sign(access.InviteToken, access.InviteClaims{InviteID: invite.ID}, access.InviteTTL)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create invitation", err.Error())
+	}
+	link := utils.SiteLink(v.DB, "/invites/accept", url.Values{"token": {token}})
+	msg := mailer.InviteMessage(email, utils.SiteName(v.DB), names.Inviter, names.Project, data.Role, link)
+
+	// Only keep the invitation if it could be delivered
+	if err := v.Mailer.Send(c.Request().Context(), msg); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to send invitation", err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create invitation", err.Error())
+	}
+
+	return utils.RespondOK(c, invite, "Invitation sent")
+}
+
+// InviteListView lists the project's pending invitations.
+func (v *ProjectContext) InviteListView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageMembers); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	invites := []Invite{}
+	err := v.DB.Select(&invites, `
+		SELECT id, project_id, email, role, invited_by, expires_at, created_at
+		FROM project_invites
+		WHERE project_id = $1 AND accepted_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`, projectID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch invitations", err)
+	}
+
+	return utils.RespondOK(c, invites, "")
+}
+
+// InviteDeleteView withdraws a pending invitation, voiding its link.
+func (v *ProjectContext) InviteDeleteView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	inviteID := c.Param("invite_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageMembers); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	result, err := v.DB.Exec(`
+		DELETE FROM project_invites
+		WHERE project_id = $1 AND id = $2 AND accepted_at IS NULL
+	`, projectID, inviteID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to delete invitation", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return utils.RespondFail(c, http.StatusNotFound, "Invitation not found", nil)
+	}
+
+	return utils.RespondOK(c, nil, "Invitation deleted successfully")
+}
+
+// APITokenListView lists the project's API tokens, without the tokens.
+func (v *ProjectContext) APITokenListView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	tokens := []APIToken{}
+	err := v.DB.Select(&tokens, `
+		SELECT id, project_id, name, created_by, last_used_at, created_at
+		FROM project_api_tokens
+		WHERE project_id = $1
+		ORDER BY created_at DESC
+	`, projectID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch API tokens", err)
+	}
+
+	return utils.RespondOK(c, tokens, "")
+}
+
+// APITokenCreateView creates a token CI can record releases, deploys and
+// artifacts with. It acts as the user creating it and stops working when
+// that user is deactivated.
+func (v *ProjectContext) APITokenCreateView(c echo.Context) error {
+	user := access.CurrentUser(c)
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	var data APITokenNew
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	token, hash := access.NewAPIToken()
+	created := APITokenCreated{Token: token}
+	err := v.DB.Get(&created.APIToken, `
+		INSERT INTO project_api_tokens (id, project_id, name, token_hash, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, project_id, name, created_by, last_used_at, created_at
+	`, utils.GenerateID("pat"), projectID, strings.TrimSpace(data.Name), hash, user.ID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create API token", err)
+	}
+
+	return utils.RespondOK(c, created, "API token created successfully")
+}
+
+// APITokenDeleteView revokes an API token.
+func (v *ProjectContext) APITokenDeleteView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	tokenID := c.Param("token_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	result, err := v.DB.Exec(`
+		DELETE FROM project_api_tokens
+		WHERE project_id = $1 AND id = $2
+	`, projectID, tokenID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to delete API token", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return utils.RespondFail(c, http.StatusNotFound, "API token not found", nil)
+	}
+
+	return utils.RespondOK(c, nil, "API token deleted successfully")
+}
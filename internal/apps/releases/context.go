@@ -0,0 +1,11 @@
+package releases
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+type ReleaseContext struct {
+	DB    *sqlx.DB
+	Cache *redis.Client
+}
@@ -0,0 +1,76 @@
+package releases
+
+import "time"
+
+type Release struct {
+	ID                  string     `db:"id" json:"id"`
+	ProjectID           string     `db:"project_id" json:"projectId"`
+	Version             string     `db:"version" json:"version"`
+	Ref                 *string    `db:"ref" json:"ref"`
+	URL                 *string    `db:"url" json:"url"`
+	ReleasedAt          *time.Time `db:"released_at" json:"releasedAt"`
+	FirstEventAt        *time.Time `db:"first_event_at" json:"firstEventAt"`
+	LastEventAt         *time.Time `db:"last_event_at" json:"lastEventAt"`
+	EventCount          int64      `db:"event_count" json:"eventCount"`
+	NewIssueCount       int64      `db:"new_issue_count" json:"newIssueCount"`
+	RegressedIssueCount int64      `db:"regressed_issue_count" json:"regressedIssueCount"`
+	LastDeployAt        *time.Time `db:"last_deploy_at" json:"lastDeployAt"`
+	CreatedAt           time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt           time.Time  `db:"updated_at" json:"-"`
+}
+
+type Deploy struct {
+	ID          string     `db:"id" json:"id"`
+	ReleaseID   string     `db:"release_id" json:"releaseId"`
+	ProjectID   string     `db:"project_id" json:"projectId"`
+	Environment string     `db:"environment" json:"environment"`
+	Name        *string    `db:"name" json:"name"`
+	URL         *string    `db:"url" json:"url"`
+	StartedAt   *time.Time `db:"started_at" json:"startedAt"`
+	FinishedAt  time.Time  `db:"finished_at" json:"finishedAt"`
+	CreatedBy   *string    `db:"created_by" json:"createdBy"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+}
+
+// ReleaseIssue is an issue as listed on a release.
+type ReleaseIssue struct {
+	ID           string     `db:"id" json:"id"`
+	Status       string     `db:"status" json:"status"`
+	IsRegression bool       `db:"is_regression" json:"isRegression"`
+	Level        *string    `db:"level" json:"level"`
+	Type         *string    `db:"type" json:"type"`
+	Message      *string    `db:"message" json:"message"`
+	EventCount   int64      `db:"event_count" json:"eventCount"`
+	UserCount    int64      `db:"user_count" json:"userCount"`
+	FirstSeen    *time.Time `db:"first_seen_at" json:"firstSeen"`
+	LastSeen     *time.Time `db:"last_seen_at" json:"lastSeen"`
+	FirstRelease *string    `db:"first_release" json:"firstRelease"`
+	LastRelease  *string    `db:"last_release" json:"lastRelease"`
+}
+
+type RegressedIssue struct {
+	ReleaseIssue
+	RegressedAt time.Time `db:"regressed_at" json:"regressedAt"`
+}
+
+type ReleaseDetail struct {
+	Release
+	Deploys         []Deploy         `json:"deploys"`
+	NewIssues       []ReleaseIssue   `json:"newIssues"`
+	RegressedIssues []RegressedIssue `json:"regressedIssues"`
+}
+
+type ReleaseNew struct {
+	Version    string     `json:"version" validate:"required,max=200"`
+	Ref        *string    `json:"ref" validate:"omitempty,max=200"`
+	URL        *string    `json:"url" validate:"omitempty,url"`
+	ReleasedAt *time.Time `json:"releasedAt"`
+}
+
+type DeployNew struct {
+	Environment string     `json:"environment" validate:"required,max=64"`
+	Name        *string    `json:"name" validate:"omitempty,max=200"`
+	URL         *string    `json:"url" validate:"omitempty,url"`
+	StartedAt   *time.Time `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt"`
+}
@@ -0,0 +1,275 @@
+package releases
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/santoshkpatro/unbit/internal/access"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+const (
+	defaultListLimit = 25
+	maxListLimit     = 100
+)
+
+// releaseColumns selects a release r along with its issue and deploy counts.
+// New issues are those first seen in the release, regressed ones were
+// resolved and came back with an event from it.
+const releaseColumns = `
+	r.*,
+	(
+		SELECT count(*) FROM issues i
+		WHERE i.project_id = r.project_id AND i.first_release = r.version
+	) AS new_issue_count,
+	(
+		SELECT count(DISTINCT a.issue_id) FROM issue_activities a
+		WHERE a.project_id = r.project_id AND a.kind = 'regression' AND a.data ->> 'release' = r.version
+	) AS regressed_issue_count,
+	(
+		SELECT MAX(d.finished_at) FROM deploys d WHERE d.release_id = r.id
+	) AS last_deploy_at
+`
+
+const releaseIssueColumns = `
+	i.id,
+	i.status,
+	i.is_regression,
+	i.level,
+	i.type,
+	i.message,
+	i.event_count,
+	i.user_count,
+	i.first_seen_at,
+	i.last_seen_at,
+	i.first_release,
+	i.last_release
+`
+
+// releaseVersion reads the release version from the path. Versions such as
+// my-app@1.2.0+build.7 may arrive escaped.
+func releaseVersion(c echo.Context) (string, error) {
+	return url.PathUnescape(c.Param("release"))
+}
+
+func parseLimit(c echo.Context) (int, error) {
+	limit := c.QueryParam("limit")
+	if limit == "" {
+		return defaultListLimit, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxListLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+	return n, nil
+}
+
+func getRelease(db sqlx.Queryer, projectID, version string) (Release, error) {
+	var release Release
+	err := sqlx.Get(db, &release, `
+		SELECT `+releaseColumns+`
+		FROM releases r
+		WHERE r.project_id = $1 AND r.version = $2
+	`, projectID, version)
+	return release, err
+}
+
+func (v *ReleaseContext) ReleaseListView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	limit, err := parseLimit(c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid limit", err.Error())
+	}
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ViewProject); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	releases := []Release{}
+	err = v.DB.Select(&releases, `
+		SELECT `+releaseColumns+`
+		FROM releases r
+		WHERE r.project_id = $1
+		ORDER BY COALESCE(r.released_at, r.first_event_at, r.created_at) DESC, r.id DESC
+		LIMIT $2
+	`, projectID, limit)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch releases", err)
+	}
+
+	return utils.RespondOK(c, releases, "")
+}
+
+// ReleaseCreateView registers a release ahead of its events, typically from
+// CI. Creating an existing version fills in the details given.
+func (v *ReleaseContext) ReleaseCreateView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageReleases); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	var data ReleaseNew
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	_, err := v.DB.Exec(`
+		INSERT INTO releases (id, project_id, version, ref, url, released_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (project_id, version) DO UPDATE SET
+			ref = COALESCE(EXCLUDED.ref, releases.ref),
+			url = COALESCE(EXCLUDED.url, releases.url),
+			released_at = COALESCE(EXCLUDED.released_at, releases.released_at),
+			updated_at = NOW()
+	`, utils.GenerateID("rel"), projectID, data.Version, data.Ref, data.URL, data.ReleasedAt)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create release", err)
+	}
+
+	release, err := getRelease(v.DB, projectID, data.Version)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch release", err)
+	}
+
+	return utils.RespondOK(c, release, "Release created successfully")
+}
+
+// ReleaseDetailView shows a release with its deploys and the issues it
+// introduced or brought back.
+func (v *ReleaseContext) ReleaseDetailView(c echo.Context) error {
+	projectID := c.Param("project_id")
+	version, err := releaseVersion(c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid release", err.Error())
+	}
+	limit, err := parseLimit(c)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid limit", err.Error())
+	}
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ViewProject); err != nil {
+		return access.RespondDenied(c, err, "Release not found")
+	}
+
+	release, err := getRelease(v.DB, projectID, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.RespondFail(c, http.StatusNotFound, "Release not found", nil)
+	}
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch release", err)
+	}
+
+	detail := ReleaseDetail{
+		Release:         release,
+		Deploys:         []Deploy{},
+		NewIssues:       []ReleaseIssue{},
+		RegressedIssues: []RegressedIssue{},
+	}
+
+	err = v.DB.Select(&detail.Deploys, `
+		SELECT * FROM deploys WHERE release_id = $1 ORDER BY finished_at DESC
+	`, release.ID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch deploys", err)
+	}
+
+	err = v.DB.Select(&detail.NewIssues, `
+		SELECT `+releaseIssueColumns+`
+		FROM issues i
+		WHERE i.project_id = $1 AND i.first_release = $2
+		ORDER BY i.first_seen_at DESC, i.id DESC
+		LIMIT $3
+	`, projectID, version, limit)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch new issues", err)
+	}
+
+	err = v.DB.Select(&detail.RegressedIssues, `
+		SELECT `+releaseIssueColumns+`, r.regressed_at
+		FROM (
+			SELECT a.issue_id, MAX(a.created_at) AS regressed_at
+			FROM issue_activities a
+			WHERE a.project_id = $1 AND a.kind = 'regression' AND a.data ->> 'release' = $2
+			GROUP BY a.issue_id
+		) r
+		JOIN issues i ON i.id = r.issue_id
+		ORDER BY r.regressed_at DESC, i.id DESC
+		LIMIT $3
+	`, projectID, version, limit)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to fetch regressed issues", err)
+	}
+
+	return utils.RespondOK(c, detail, "")
+}
+
+// DeployCreateView records a deploy of a release to an environment, creating
+// the release if CI hasn't registered it yet. The first deploy marks the
+// release as released.
+func (v *ReleaseContext) DeployCreateView(c echo.Context) error {
+	user := access.CurrentUser(c)
+	projectID := c.Param("project_id")
+	version, err := releaseVersion(c)
+	if err != nil || version == "" || len(version) > 200 {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid release", nil)
+	}
+	if err := access.AuthorizeProject(c, v.DB, projectID, access.ManageReleases); err != nil {
+		return access.RespondDenied(c, err, "Project not found")
+	}
+
+	var data DeployNew
+	if err := c.Bind(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Invalid request payload", err.Error())
+	}
+	if err := c.Validate(&data); err != nil {
+		return utils.RespondFail(c, http.StatusBadRequest, "Validation failed", err.Error())
+	}
+	finishedAt := time.Now().UTC()
+	if data.FinishedAt != nil {
+		finishedAt = *data.FinishedAt
+	}
+
+	tx, err := v.DB.Beginx()
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Database error", err.Error())
+	}
+	defer tx.Rollback()
+
+	var releaseID string
+	err = tx.Get(&releaseID, `
+		INSERT INTO releases (id, project_id, version, released_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (project_id, version) DO UPDATE SET
+			released_at = COALESCE(releases.released_at, EXCLUDED.released_at),
+			updated_at = NOW()
+		RETURNING id
+	`, utils.GenerateID("rel"), projectID, version, finishedAt)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to create release", err)
+	}
+
+	var deploy Deploy
+	err = tx.Get(&deploy, `
+		INSERT INTO deploys (id, release_id, project_id, environment, name, url, started_at, finished_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING *
+	`, utils.GenerateID("dep"), releaseID, projectID, data.Environment, data.Name, data.URL,
+		data.StartedAt, finishedAt, user.ID)
+	if err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to record deploy", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return utils.RespondFail(c, http.StatusInternalServerError, "Failed to record deploy", err.Error())
+	}
+
+	return utils.RespondOK(c, deploy, "Deploy recorded successfully")
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/santoshkpatro/unbit/internal/mailer"
+)
+
+// NewMailer returns the mailer chosen by MAILER: smtp sends through
+// SMTP_HOST, file writes .eml files to MAIL_DIR and log only notes that a
+// message would be sent. Without MAILER nothing is sent, which is logged
+// loudly at startup.
+func NewMailer() (mailer.Mailer, error) {
+	switch Env.Mailer {
+	case "":
+		log.Printf("⚠️  MAILER is not set, emails are not sent. Set MAILER=smtp to deliver verification, invitation and password reset links")
+		return mailer.LogMailer{}, nil
+	case "smtp":
+		port, err := strconv.Atoi(Env.SmtpPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT %q", Env.SmtpPort)
+		}
+		return &mailer.SMTPMailer{
+			Host:     Env.SmtpHost,
+			Port:     port,
+			Username: Env.SmtpUsername,
+			Password: Env.SmtpPassword,
+			From:     Env.MailFrom,
+		}, nil
+	case "file":
+		return &mailer.FileMailer{Dir: Env.MailDir, From: Env.MailFrom}, nil
+	case "log":
+		return mailer.LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q, expected smtp, file or log", Env.Mailer)
+	}
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 5,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				ALTER TABLE projects ADD COLUMN IF NOT EXISTS dsn_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				ALTER TABLE projects DROP COLUMN IF EXISTS dsn_enabled;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
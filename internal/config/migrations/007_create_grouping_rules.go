@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 7,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS grouping_rules (
+					id TEXT PRIMARY KEY,
+					project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					position INT NOT NULL DEFAULT 0,
+					type_pattern TEXT NOT NULL DEFAULT '',
+					message_pattern TEXT NOT NULL DEFAULT '',
+					file_pattern TEXT NOT NULL DEFAULT '',
+					function_pattern TEXT NOT NULL DEFAULT '',
+					fingerprint TEXT[] NOT NULL,
+					created_at TIMESTAMPTZ DEFAULT NOW(),
+					updated_at TIMESTAMPTZ DEFAULT NOW()
+				);
+				CREATE INDEX IF NOT EXISTS idx_grouping_rules_project_id ON grouping_rules(project_id, position);
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP TABLE IF EXISTS grouping_rules;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
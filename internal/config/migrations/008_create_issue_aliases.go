@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 8,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				ALTER TABLE events ADD COLUMN IF NOT EXISTS fingerprint TEXT;
+				CREATE INDEX IF NOT EXISTS idx_events_issue_fingerprint ON events(issue_id, fingerprint);
+
+				CREATE TABLE IF NOT EXISTS issue_aliases (
+					project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					fingerprint TEXT NOT NULL,
+					issue_id TEXT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+					created_at TIMESTAMPTZ DEFAULT NOW(),
+					PRIMARY KEY (project_id, fingerprint)
+				);
+				CREATE INDEX IF NOT EXISTS idx_issue_aliases_issue_id ON issue_aliases(issue_id);
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP TABLE IF EXISTS issue_aliases;
+				DROP INDEX IF EXISTS idx_events_issue_fingerprint;
+				ALTER TABLE events DROP COLUMN IF EXISTS fingerprint;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
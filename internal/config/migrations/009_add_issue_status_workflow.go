@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 9,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMPTZ;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS ignored_until TIMESTAMPTZ;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS ignored_until_count BIGINT;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS is_regression BOOLEAN NOT NULL DEFAULT FALSE;
+
+				CREATE TABLE IF NOT EXISTS issue_activities (
+					id TEXT PRIMARY KEY,
+					issue_id TEXT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+					project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+					kind TEXT NOT NULL,
+					data JSONB NOT NULL DEFAULT '{}',
+					created_at TIMESTAMPTZ DEFAULT NOW()
+				);
+				CREATE INDEX IF NOT EXISTS idx_issue_activities_issue_id ON issue_activities(issue_id, created_at);
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP TABLE IF EXISTS issue_activities;
+				ALTER TABLE issues DROP COLUMN IF EXISTS is_regression;
+				ALTER TABLE issues DROP COLUMN IF EXISTS ignored_until_count;
+				ALTER TABLE issues DROP COLUMN IF EXISTS ignored_until;
+				ALTER TABLE issues DROP COLUMN IF EXISTS resolved_at;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
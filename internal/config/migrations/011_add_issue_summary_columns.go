@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/santoshkpatro/unbit/internal/worker"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 11,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS first_seen_at TIMESTAMPTZ;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS level TEXT;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS type TEXT;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS message TEXT;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS user_count BIGINT NOT NULL DEFAULT 0;
+
+				UPDATE issues i
+				SET first_seen_at = s.first_seen_at,
+					last_seen_at = s.last_seen_at,
+					level = s.level,
+					type = s.type,
+					message = s.message,
+					user_count = s.user_count
+				FROM (
+					SELECT
+						issue_id,
+						MIN(timestamp) AS first_seen_at,
+						MAX(timestamp) AS last_seen_at,
+						(array_agg(properties ->> 'level' ORDER BY timestamp DESC))[1] AS level,
+						(array_agg(properties ->> 'type' ORDER BY timestamp DESC))[1] AS type,
+						(array_agg(properties ->> 'message' ORDER BY timestamp DESC))[1] AS message,
+						COUNT(DISTINCT `+worker.UserKeySQL+`) AS user_count
+					FROM events
+					GROUP BY issue_id
+				) s
+				WHERE i.id = s.issue_id;
+
+				UPDATE issues SET first_seen_at = created_at WHERE first_seen_at IS NULL;
+				UPDATE issues SET last_seen_at = updated_at WHERE last_seen_at IS NULL;
+
+				CREATE INDEX IF NOT EXISTS idx_issues_project_last_seen ON issues(project_id, last_seen_at DESC, id DESC);
+				CREATE INDEX IF NOT EXISTS idx_issues_project_first_seen ON issues(project_id, first_seen_at DESC, id DESC);
+				CREATE INDEX IF NOT EXISTS idx_issues_project_event_count ON issues(project_id, event_count DESC, id DESC);
+				CREATE INDEX IF NOT EXISTS idx_issues_project_user_count ON issues(project_id, user_count DESC, id DESC);
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP INDEX IF EXISTS idx_issues_project_user_count;
+				DROP INDEX IF EXISTS idx_issues_project_event_count;
+				DROP INDEX IF EXISTS idx_issues_project_first_seen;
+				DROP INDEX IF EXISTS idx_issues_project_last_seen;
+				ALTER TABLE issues DROP COLUMN IF EXISTS user_count;
+				ALTER TABLE issues DROP COLUMN IF EXISTS message;
+				ALTER TABLE issues DROP COLUMN IF EXISTS type;
+				ALTER TABLE issues DROP COLUMN IF EXISTS level;
+				ALTER TABLE issues DROP COLUMN IF EXISTS last_seen_at;
+				ALTER TABLE issues DROP COLUMN IF EXISTS first_seen_at;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
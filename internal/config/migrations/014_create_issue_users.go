@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/santoshkpatro/unbit/internal/worker"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 14,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS issue_users (
+					issue_id TEXT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+					user_key TEXT NOT NULL,
+					created_at TIMESTAMPTZ DEFAULT NOW(),
+					PRIMARY KEY (issue_id, user_key)
+				);
+
+				-- Issues counted their users from events so far, list them from there
+				INSERT INTO issue_users (issue_id, user_key, created_at)
+				SELECT issue_id, user_key, MIN(timestamp)
+				FROM (
+					SELECT issue_id, timestamp, `+worker.UserKeySQL+` AS user_key
+					FROM events
+					WHERE issue_id IS NOT NULL
+				) e
+				WHERE user_key IS NOT NULL
+				GROUP BY issue_id, user_key
+				ON CONFLICT DO NOTHING;
+
+				UPDATE issues i
+				SET user_count = u.n
+				FROM (SELECT issue_id, COUNT(*) AS n FROM issue_users GROUP BY issue_id) u
+				WHERE i.id = u.issue_id;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP TABLE IF EXISTS issue_users;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
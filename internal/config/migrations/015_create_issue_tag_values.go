@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 15,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS issue_tag_values (
+					issue_id TEXT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+					key TEXT NOT NULL,
+					value TEXT NOT NULL,
+					count BIGINT NOT NULL DEFAULT 0,
+					first_seen TIMESTAMPTZ NOT NULL,
+					last_seen TIMESTAMPTZ NOT NULL,
+					PRIMARY KEY (issue_id, key, value)
+				);
+
+				INSERT INTO issue_tag_values (issue_id, key, value, count, first_seen, last_seen)
+				SELECT issue_id, key, value, count(*), MIN(timestamp), MAX(timestamp)
+				FROM (
+					SELECT e.issue_id, e.timestamp, t.key, t.value
+					FROM events e, jsonb_each_text(COALESCE(e.properties -> 'tags', '{}'::jsonb)) t
+					UNION ALL
+					SELECT issue_id, timestamp, 'runtime', left(trim(concat_ws(' ', properties -> 'runtime' ->> 'name', properties -> 'runtime' ->> 'version')), 200)
+					FROM events
+					WHERE properties -> 'tags' -> 'runtime' IS NULL
+					UNION ALL
+					SELECT issue_id, timestamp, 'os', left(trim(concat_ws(' ', properties -> 'os' ->> 'name', properties -> 'os' ->> 'version')), 200)
+					FROM events
+					WHERE properties -> 'tags' -> 'os' IS NULL
+					UNION ALL
+					SELECT issue_id, timestamp, 'host', left(properties -> 'host' ->> 'hostname', 200)
+					FROM events
+					WHERE properties -> 'tags' -> 'host' IS NULL
+				) t
+				WHERE value IS NOT NULL AND value <> ''
+				GROUP BY issue_id, key, value
+				ON CONFLICT DO NOTHING;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP TABLE IF EXISTS issue_tag_values;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 16,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS artifacts (
+					id TEXT PRIMARY KEY,
+					project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					release TEXT NOT NULL DEFAULT '',
+					name TEXT NOT NULL,
+					content BYTEA NOT NULL,
+					size BIGINT NOT NULL,
+					checksum TEXT NOT NULL,
+					created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+					updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+					UNIQUE (project_id, release, name)
+				);
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP TABLE IF EXISTS artifacts;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 17,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS releases (
+					id TEXT PRIMARY KEY,
+					project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					version TEXT NOT NULL,
+					ref TEXT,
+					url TEXT,
+					released_at TIMESTAMPTZ,
+					first_event_at TIMESTAMPTZ,
+					last_event_at TIMESTAMPTZ,
+					event_count BIGINT NOT NULL DEFAULT 0,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+					updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+					UNIQUE (project_id, version)
+				);
+
+				CREATE TABLE IF NOT EXISTS deploys (
+					id TEXT PRIMARY KEY,
+					release_id TEXT NOT NULL REFERENCES releases(id) ON DELETE CASCADE,
+					project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					environment TEXT NOT NULL,
+					name TEXT,
+					url TEXT,
+					started_at TIMESTAMPTZ,
+					finished_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+					created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+				);
+				CREATE INDEX IF NOT EXISTS idx_deploys_release ON deploys (release_id, finished_at DESC);
+
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS first_release TEXT;
+				ALTER TABLE issues ADD COLUMN IF NOT EXISTS last_release TEXT;
+				CREATE INDEX IF NOT EXISTS idx_issues_first_release ON issues (project_id, first_release);
+				CREATE INDEX IF NOT EXISTS idx_issue_activities_regression_release
+					ON issue_activities (project_id, (data ->> 'release'))
+					WHERE kind = 'regression';
+
+				UPDATE issues i
+				SET first_release = s.first_release,
+					last_release = s.last_release
+				FROM (
+					SELECT
+						issue_id,
+						(array_agg(properties ->> 'release' ORDER BY timestamp))[1] AS first_release,
+						(array_agg(properties ->> 'release' ORDER BY timestamp DESC))[1] AS last_release
+					FROM events
+					WHERE properties ->> 'release' <> ''
+					GROUP BY issue_id
+				) s
+				WHERE i.id = s.issue_id;
+
+				INSERT INTO releases (id, project_id, version, first_event_at, last_event_at, event_count)
+				SELECT 'rel_' || left(md5(project_id || '/' || (properties ->> 'release')), 26),
+					project_id, properties ->> 'release', MIN(timestamp), MAX(timestamp), count(*)
+				FROM events
+				WHERE properties ->> 'release' <> ''
+				GROUP BY project_id, properties ->> 'release'
+				ON CONFLICT DO NOTHING;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP INDEX IF EXISTS idx_issue_activities_regression_release;
+				DROP INDEX IF EXISTS idx_issues_first_release;
+				ALTER TABLE issues DROP COLUMN IF EXISTS last_release;
+				ALTER TABLE issues DROP COLUMN IF EXISTS first_release;
+				DROP TABLE IF EXISTS deploys;
+				DROP TABLE IF EXISTS releases;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
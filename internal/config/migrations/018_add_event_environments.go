@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 18,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				ALTER TABLE projects ADD COLUMN IF NOT EXISTS group_by_environment BOOLEAN NOT NULL DEFAULT FALSE;
+
+				ALTER TABLE events ADD COLUMN IF NOT EXISTS environment TEXT;
+				UPDATE events
+				SET environment = properties ->> 'environment'
+				WHERE properties ->> 'environment' <> '';
+				CREATE INDEX IF NOT EXISTS idx_events_issue_environment ON events (issue_id, environment, timestamp DESC);
+
+				CREATE TABLE IF NOT EXISTS project_environments (
+					project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					name TEXT NOT NULL,
+					event_count BIGINT NOT NULL DEFAULT 0,
+					first_seen TIMESTAMPTZ NOT NULL,
+					last_seen TIMESTAMPTZ NOT NULL,
+					PRIMARY KEY (project_id, name)
+				);
+
+				INSERT INTO project_environments (project_id, name, event_count, first_seen, last_seen)
+				SELECT project_id, environment, count(*), MIN(timestamp), MAX(timestamp)
+				FROM events
+				WHERE environment IS NOT NULL
+				GROUP BY project_id, environment
+				ON CONFLICT DO NOTHING;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP TABLE IF EXISTS project_environments;
+				DROP INDEX IF EXISTS idx_events_issue_environment;
+				ALTER TABLE events DROP COLUMN IF EXISTS environment;
+				ALTER TABLE projects DROP COLUMN IF EXISTS group_by_environment;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
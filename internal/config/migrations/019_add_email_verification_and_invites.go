@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 19,
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+				-- Accounts from before verification existed were made by an admin
+				UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+				CREATE TABLE IF NOT EXISTS project_invites (
+					id TEXT PRIMARY KEY,
+					project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					email TEXT NOT NULL,
+					role TEXT NOT NULL,
+					invited_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+					expires_at TIMESTAMPTZ NOT NULL,
+					accepted_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+					accepted_at TIMESTAMPTZ,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+				);
+				CREATE UNIQUE INDEX IF NOT EXISTS idx_project_invites_pending
+					ON project_invites (project_id, lower(email)) WHERE accepted_at IS NULL;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration: %w", err)
+
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, `
+				DROP TABLE IF EXISTS project_invites;
+				ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+			`)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration version: %w", err)
+			}
+			return nil
+		},
+	})
+}
@@ -1,21 +1,33 @@
 package config
 
 import (
-	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 	"github.com/redis/go-redis/v9"
+	"github.com/santoshkpatro/unbit/internal/access"
 	"github.com/santoshkpatro/unbit/internal/apps/auth"
 	"github.com/santoshkpatro/unbit/internal/apps/ingest"
 	"github.com/santoshkpatro/unbit/internal/apps/issues"
 	"github.com/santoshkpatro/unbit/internal/apps/projects"
+	"github.com/santoshkpatro/unbit/internal/apps/releases"
 	"github.com/santoshkpatro/unbit/internal/apps/setting"
+	"github.com/santoshkpatro/unbit/internal/mailer"
 )
 
-func RegisterRoutes(e *echo.Echo, db *sqlx.DB, cache *redis.Client) {
+func RegisterRoutes(e *echo.Echo, db *sqlx.DB, cache *redis.Client, mail mailer.Mailer) {
 	api := e.Group("/api")
-	api.Use(session.Middleware(sessions.NewCookieStore([]byte(Env.SecretKey))))
+	sessionStore := access.NewSessionStore(cache, db, []byte(Env.SecretKey))
+	sessionStore.ExtractIP = e.IPExtractor
+	api.Use(session.Middleware(sessionStore))
+
+	// Routes on user need a logged in user, see access.CurrentUser
+	user := api.Group("", access.RequireUser(db))
+	// Routes on ci also take a project API token, for release steps in CI
+	ci := api.Group("", access.RequireUserOrToken(db))
+
+	// Tokens sign the links sent by email
+	tokens := access.NewTokens([]byte(Env.SecretKey))
 
 	// Setting routes
 	settingContext := &setting.SettingContext{
@@ -31,29 +43,90 @@ func RegisterRoutes(e *echo.Echo, db *sqlx.DB, cache *redis.Client) {
 	}
 	api.POST("/ingest/event", ingestContext.NewEvent)
 
+	// Sentry SDK compatible routes, the DSN public key identifies the project
+	api.POST("/:project/store/", ingestContext.SentryStoreEvent)
+	api.POST("/:project/envelope/", ingestContext.SentryEnvelope)
+
 	// Auth routes
 	authContext := &auth.AuthContext{
-		DB:    db,
-		Cache: cache,
+		DB:     db,
+		Cache:  cache,
+		Mailer: mail,
+		Tokens: tokens,
 	}
 	api.POST("/auth/login", authContext.LoginUser)
-	api.GET("/auth/profile", authContext.Profile)
+	api.POST("/auth/logout", authContext.LogoutUser)
+	api.POST("/auth/register", authContext.RegisterUser)
+	api.POST("/auth/verify-email", authContext.VerifyEmail)
+	api.POST("/auth/verify-email/resend", authContext.ResendVerification)
+	api.GET("/auth/invites/:token", authContext.InviteDetailView)
+	api.POST("/auth/invites/accept", authContext.AcceptInvite)
+	user.GET("/auth/profile", authContext.Profile)
 	api.GET("/auth/status", authContext.AuthStatus)
+	user.GET("/auth/sessions", authContext.SessionListView)
+	user.DELETE("/auth/sessions", authContext.SessionRevokeAllView)
+	user.DELETE("/auth/sessions/:session_id", authContext.SessionRevokeView)
+	user.POST("/auth/password/change", authContext.ChangePassword)
+	api.POST("/auth/password/forgot", authContext.ForgotPassword)
+	api.POST("/auth/password/reset", authContext.ResetPassword)
 
 	// Project routes
 	projectContext := &projects.ProjectContext{
+		DB:     db,
+		Cache:  cache,
+		Mailer: mail,
+		Tokens: tokens,
+	}
+	user.GET("/projects", projectContext.ProjectListView)
+	user.POST("/projects", projectContext.ProjectCreateView)
+	user.PATCH("/projects/:project_id", projectContext.ProjectUpdateView)
+	user.PUT("/projects/:project_id/dsn", projectContext.ProjectDSNUpdateView)
+	user.GET("/projects/:project_id/environments", projectContext.EnvironmentListView)
+	user.GET("/projects/:project_id/grouping_rules", projectContext.GroupingRuleListView)
+	user.POST("/projects/:project_id/grouping_rules", projectContext.GroupingRuleCreateView)
+	user.DELETE("/projects/:project_id/grouping_rules/:rule_id", projectContext.GroupingRuleDeleteView)
+	user.GET("/projects/:project_id/artifacts", projectContext.ArtifactListView)
+	ci.POST("/projects/:project_id/artifacts", projectContext.ArtifactUploadView)
+	user.DELETE("/projects/:project_id/artifacts/:artifact_id", projectContext.ArtifactDeleteView)
+	user.GET("/projects/:project_id/invites", projectContext.InviteListView)
+	user.POST("/projects/:project_id/invites", projectContext.InviteCreateView)
+	user.DELETE("/projects/:project_id/invites/:invite_id", projectContext.InviteDeleteView)
+	user.GET("/projects/:project_id/api_tokens", projectContext.APITokenListView)
+	user.POST("/projects/:project_id/api_tokens", projectContext.APITokenCreateView)
+	user.DELETE("/projects/:project_id/api_tokens/:token_id", projectContext.APITokenDeleteView)
+	user.GET("/projects/:project_id/releases/:release/artifacts", projectContext.ArtifactListView)
+	ci.POST("/projects/:project_id/releases/:release/artifacts", projectContext.ArtifactUploadView)
+
+	// Release routes
+	releaseContext := &releases.ReleaseContext{
 		DB:    db,
 		Cache: cache,
 	}
-	api.GET("/projects", projectContext.ProjectListView)
-	api.POST("/projects", projectContext.ProjectCreateView)
+	user.GET("/projects/:project_id/releases", releaseContext.ReleaseListView)
+	ci.POST("/projects/:project_id/releases", releaseContext.ReleaseCreateView)
+	user.GET("/projects/:project_id/releases/:release", releaseContext.ReleaseDetailView)
+	ci.POST("/projects/:project_id/releases/:release/deploys", releaseContext.DeployCreateView)
 
 	// Issues routes
 	issueContext := &issues.IssueContext{
 		DB:    db,
 		Cache: cache,
 	}
-	api.GET("/issues/recent", issueContext.RecentIssueListView)
-	api.GET("/issues/:issue_id", issueContext.IssueDetailsView)
-	api.GET("/issues/:issue_id/previous_events", issueContext.PreviousEventsView)
+	user.GET("/issues/recent", issueContext.RecentIssueListView)
+	user.GET("/issues/search", issueContext.IssueSearchView)
+	user.GET("/issues/:issue_id", issueContext.IssueDetailsView)
+	user.GET("/issues/:issue_id/previous_events", issueContext.PreviousEventsView)
+	user.GET("/issues/:issue_id/events", issueContext.IssueEventListView)
+	user.GET("/issues/:issue_id/events/:event_id", issueContext.IssueEventView)
+	user.GET("/issues/:issue_id/fingerprints", issueContext.IssueFingerprintListView)
+	user.POST("/issues/:issue_id/merge", issueContext.MergeIssuesView)
+	user.POST("/issues/:issue_id/unmerge", issueContext.UnmergeIssueView)
+	user.POST("/issues/:issue_id/resolve", issueContext.ResolveIssueView)
+	user.POST("/issues/:issue_id/ignore", issueContext.IgnoreIssueView)
+	user.POST("/issues/:issue_id/reopen", issueContext.ReopenIssueView)
+	user.POST("/issues/:issue_id/assign", issueContext.AssignIssueView)
+	user.POST("/issues/:issue_id/unassign", issueContext.UnassignIssueView)
+	user.GET("/issues/:issue_id/activity", issueContext.IssueActivityListView)
+	user.GET("/issues/:issue_id/tags", issueContext.IssueTagListView)
+	user.GET("/events/:event_id", issueContext.EventDetailView)
 }
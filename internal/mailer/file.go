@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+// FileMailer writes each message to an .eml file in Dir, for development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if _, err := address(msg.To); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := utils.GenerateID("mail") + ".eml"
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o644)
+}
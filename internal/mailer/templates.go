@@ -0,0 +1,59 @@
+package mailer
+
+import "fmt"
+
+// VerifyEmailMessage asks a new user to confirm their address.
+func VerifyEmailMessage(to, siteName, link string) Message {
+	return Message{
+		To:      to,
+		Subject: fmt.Sprintf("Verify your email for %s", siteName),
+		Body: fmt.Sprintf(`Hi,
+
+Please confirm that %s is your email address by opening the link below:
+
+%s
+
+The link expires in 48 hours. If you didn't sign up for %s, you can ignore this email.
+
+— %s
+`, to, link, siteName, siteName),
+	}
+}
+
+// InviteMessage invites someone to join a project.
+func InviteMessage(to, siteName, inviter, project, role, link string) Message {
+	return Message{
+		To:      to,
+		Subject: fmt.Sprintf("%s invited you to %s on %s", inviter, project, siteName),
+		Body: fmt.Sprintf(`Hi,
+
+%s invited you to join the project %s on %s as %s.
+
+Accept the invitation by opening the link below:
+
+%s
+
+The invitation expires in 7 days.
+
+— %s
+`, inviter, project, siteName, role, link, siteName),
+	}
+}
+
+// PasswordResetMessage sends a link to choose a new password.
+func PasswordResetMessage(to, siteName, link string) Message {
+	return Message{
+		To:      to,
+		Subject: fmt.Sprintf("Reset your %s password", siteName),
+		Body: fmt.Sprintf(`Hi,
+
+Someone asked to reset the password of your %s account. Choose a new password by opening the link below:
+
+%s
+
+The link can be used once and expires in 1 hour. If you didn't ask for this, you can ignore this email and your password stays the same.
+
+— %s
+`, siteName, link, siteName),
+	}
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Frame struct {
@@ -10,31 +12,120 @@ type Frame struct {
 	File     string `json:"file"`
 	Line     int    `json:"line"`
 	Code     string `json:"code"`
+	Column   int    `json:"column,omitempty"`
+	Module   string `json:"module,omitempty"`
+	// InApp marks frames of the application itself rather than of its
+	// dependencies. Unset means unknown and is guessed from the file path.
+	InApp       *bool                      `json:"inApp,omitempty"`
+	PreContext  []string                   `json:"preContext,omitempty"`
+	PostContext []string                   `json:"postContext,omitempty"`
+	Vars        map[string]json.RawMessage `json:"vars,omitempty"`
+	// Raw is the frame as reported, kept when the worker resolved it
+	// through a source map.
+	Raw *Frame `json:"raw,omitempty"`
+}
+
+type Mechanism struct {
+	Type        string `json:"type"`
+	Handled     *bool  `json:"handled,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Exception is one link of an exception chain.
+type Exception struct {
+	Type       string     `json:"type"`
+	Value      string     `json:"value"`
+	Module     string     `json:"module,omitempty"`
+	Mechanism  *Mechanism `json:"mechanism,omitempty"`
+	Stacktrace []Frame    `json:"stacktrace"`
 }
 
+// ThreadStack is the stack of one thread at the time of the event.
+type ThreadStack struct {
+	ID         string  `json:"id,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	Crashed    bool    `json:"crashed,omitempty"`
+	Current    bool    `json:"current,omitempty"`
+	Stacktrace []Frame `json:"stacktrace"`
+}
+
+const (
+	IssueUnresolved = "unresolved"
+	IssueResolved   = "resolved"
+	IssueIgnored    = "ignored"
+)
+
 type Issue struct {
-	ID          string    `db:"id"`
-	ProjectID   string    `db:"project_id"`
-	Fingerprint string    `db:"fingerprint"`
-	AssigneeID  *string   `db:"assignee_id"`
-	Status      string    `db:"status"`
-	EventCount  int64     `db:"event_count"`
-	CreatedAt   time.Time `db:"created_at"`
-	UpdatedAt   time.Time `db:"updated_at"`
+	ID                string     `db:"id"`
+	ProjectID         string     `db:"project_id"`
+	Fingerprint       string     `db:"fingerprint"`
+	AssigneeID        *string    `db:"assignee_id"`
+	Status            string     `db:"status"`
+	EventCount        int64      `db:"event_count"`
+	ResolvedAt        *time.Time `db:"resolved_at"`
+	IgnoredUntil      *time.Time `db:"ignored_until"`
+	IgnoredUntilCount *int64     `db:"ignored_until_count"`
+	IsRegression      bool       `db:"is_regression"`
+	AssignedBy        *string    `db:"assigned_by"`
+	AssignedAt        *time.Time `db:"assigned_at"`
+	FirstSeenAt       *time.Time `db:"first_seen_at"`
+	LastSeenAt        *time.Time `db:"last_seen_at"`
+	Level             *string    `db:"level"`
+	Type              *string    `db:"type"`
+	Message           *string    `db:"message"`
+	UserCount         int64      `db:"user_count"`
+	FirstRelease      *string    `db:"first_release"`
+	LastRelease       *string    `db:"last_release"`
+	CreatedAt         time.Time  `db:"created_at"`
+	UpdatedAt         time.Time  `db:"updated_at"`
+}
+
+type Breadcrumb struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Type      string          `json:"type,omitempty"`
+	Category  string          `json:"category,omitempty"`
+	Level     string          `json:"level,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+type User struct {
+	ID        string `json:"id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	IPAddress string `json:"ipAddress,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+type Request struct {
+	URL     string            `json:"url,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 type Properties struct {
-	Type       string          `json:"type"`
-	Message    string          `json:"message"`
-	Level      string          `json:"level"`
-	Stacktrace []Frame         `json:"stacktrace"`
-	Runtime    json.RawMessage `json:"runtime"`
-	OS         json.RawMessage `json:"os"`
-	Process    json.RawMessage `json:"process"`
-	Thread     json.RawMessage `json:"thread"`
-	Argv       []string        `json:"argv"`
-	Executable string          `json:"executable"`
-	Host       json.RawMessage `json:"host"`
+	Type        string            `json:"type"`
+	Message     string            `json:"message"`
+	Level       string            `json:"level"`
+	Stacktrace  []Frame           `json:"stacktrace"`
+	Runtime     json.RawMessage   `json:"runtime"`
+	OS          json.RawMessage   `json:"os"`
+	Process     json.RawMessage   `json:"process"`
+	Thread      json.RawMessage   `json:"thread"`
+	Argv        []string          `json:"argv"`
+	Executable  string            `json:"executable"`
+	Host        json.RawMessage   `json:"host"`
+	Fingerprint []string          `json:"fingerprint,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Breadcrumbs []Breadcrumb      `json:"breadcrumbs,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        *User             `json:"user,omitempty"`
+	Request     *Request          `json:"request,omitempty"`
+	Extra       json.RawMessage   `json:"extra,omitempty"`
+	// Exceptions is the exception chain, starting with the one raised and
+	// followed by its causes. Type, Message and Stacktrace mirror the first.
+	Exceptions []Exception   `json:"exceptions,omitempty"`
+	Threads    []ThreadStack `json:"threads,omitempty"`
 }
 
 type Event struct {
@@ -43,6 +134,25 @@ type Event struct {
 }
 
 type Payload struct {
-	DSNToken string `json:"dsnToken"`
-	Event    Event  `json:"event"`
+	DSNToken  string `json:"dsnToken"`
+	ProjectID string `json:"projectId,omitempty"`
+	// EventID is given on enqueue and kept through retries, so an event
+	// delivered twice is only stored once.
+	EventID string `json:"eventId,omitempty"`
+	Event   Event  `json:"event"`
+}
+
+// GroupingRule sends events matching every non-empty pattern to the issue
+// identified by Fingerprint. Patterns are globs where * matches anything.
+type GroupingRule struct {
+	ID              string         `db:"id" json:"id"`
+	ProjectID       string         `db:"project_id" json:"projectId"`
+	Position        int            `db:"position" json:"position"`
+	TypePattern     string         `db:"type_pattern" json:"typePattern"`
+	MessagePattern  string         `db:"message_pattern" json:"messagePattern"`
+	FilePattern     string         `db:"file_pattern" json:"filePattern"`
+	FunctionPattern string         `db:"function_pattern" json:"functionPattern"`
+	Fingerprint     pq.StringArray `db:"fingerprint" json:"fingerprint"`
+	CreatedAt       time.Time      `db:"created_at" json:"createdAt"`
+	UpdatedAt       time.Time      `db:"updated_at" json:"-"`
 }
@@ -0,0 +1,363 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kind is how a field's values are parsed and compared.
+type Kind int
+
+const (
+	// KindText matches exactly, or as ILIKE when the value contains *.
+	KindText Kind = iota
+	// KindContains matches values as case insensitive substrings.
+	KindContains
+	KindNumber
+	// KindTime accepts RFC 3339 timestamps, dates and relative times such
+	// as -24h or -7d.
+	KindTime
+	// KindUser is a user id column where "me" is the current user and
+	// "none" matches nothing assigned.
+	KindUser
+	// KindJSON is a text value extracted from JSON; comparisons cast to numeric.
+	KindJSON
+)
+
+// Field maps a query key onto a SQL expression.
+type Field struct {
+	Column string
+	Kind   Kind
+	// Wrap, if set, is a format string the condition is embedded in, such
+	// as an EXISTS subquery over a related table.
+	Wrap string
+}
+
+// Schema describes the keys a query may use against one table.
+type Schema struct {
+	Fields map[string]Field
+	// FreeText is the field bare words are matched against.
+	FreeText Field
+	// Is maps is:<value> filters to SQL conditions.
+	Is map[string]string
+	// Tags, if set, is the JSONB object tags.<key> filters match against, using containment so a GIN index applies.
+	Tags *Field
+	// Property resolves keys that are not in Fields, such as runtime.name.
+	// It is given the key split on dots and a function registering a SQL
+	// parameter. A nil Property rejects unknown keys.
+	Property func(path []string, arg func(interface{}) string) Field
+}
+
+// Compiler turns parsed queries into SQL conditions. Values never end up in
+// the SQL text, they are passed through Arg as parameters.
+type Compiler struct {
+	Schema *Schema
+	Arg    func(interface{}) string
+	UserID string
+	Now    time.Time
+}
+
+// Compile renders node as a SQL boolean expression.
+func (c *Compiler) Compile(node Node) (string, error) {
+	switch n := node.(type) {
+	case And:
+		return c.join(n.Nodes, " AND ")
+	case Or:
+		return c.join(n.Nodes, " OR ")
+	case Not:
+		inner, err := c.Compile(n.Node)
+		if err != nil {
+			return "", err
+		}
+		// NULL comparisons count as no match, so the negation matches them
+		return "NOT COALESCE(" + inner + ", FALSE)", nil
+	case Term:
+		return c.term(n)
+	}
+	return "", fmt.Errorf("unsupported query node %T", node)
+}
+
+func (c *Compiler) join(nodes []Node, sep string) (string, error) {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		sql, err := c.Compile(n)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = sql
+	}
+	return "(" + strings.Join(parts, sep) + ")", nil
+}
+
+func (c *Compiler) term(t Term) (string, error) {
+	switch t.Key {
+	case "":
+		return c.compare(c.Schema.FreeText, Term{Op: OpEq, Values: t.Values}, KindContains)
+	case "is":
+		return c.is(t)
+	case "has":
+		return c.has(t)
+	}
+	if c.Schema.Tags != nil && strings.HasPrefix(t.Key, "tags.") {
+		return c.tag(strings.TrimPrefix(t.Key, "tags."), t)
+	}
+
+	field, err := c.field(t.Key)
+	if err != nil {
+		return "", err
+	}
+	return c.compare(field, t, field.Kind)
+}
+
+func (c *Compiler) field(key string) (Field, error) {
+	if f, ok := c.Schema.Fields[key]; ok {
+		return f, nil
+	}
+	if c.Schema.Property == nil {
+		return Field{}, fmt.Errorf("unknown key %q", key)
+	}
+	return c.Schema.Property(strings.Split(key, "."), c.Arg), nil
+}
+
+func (c *Compiler) is(t Term) (string, error) {
+	if t.Op != OpEq {
+		return "", fmt.Errorf("is: does not support %s", t.Op)
+	}
+	conds := make([]string, len(t.Values))
+	for i, v := range t.Values {
+		cond, ok := c.Schema.Is[strings.ToLower(v)]
+		if !ok {
+			return "", fmt.Errorf("unknown filter is:%s", v)
+		}
+		conds[i] = cond
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", nil
+}
+
+// tag matches a tag exactly through containment, and falls back to reading
+// the value for wildcards.
+func (c *Compiler) tag(key string, t Term) (string, error) {
+	if t.Op != OpEq {
+		return "", fmt.Errorf("%s: %s is not supported on tags", t.Key, t.Op)
+	}
+
+	tags := *c.Schema.Tags
+	var conds []string
+	for _, v := range t.Values {
+		if strings.Contains(v, "*") {
+			conds = append(conds, "("+tags.Column+" ->> "+c.Arg(key)+"::text) ILIKE "+c.Arg(likePattern(v)))
+			continue
+		}
+		value, _ := json.Marshal(map[string]string{key: v})
+		conds = append(conds, tags.Column+" @> "+c.Arg(string(value))+"::jsonb")
+	}
+
+	cond := conds[0]
+	if len(conds) > 1 {
+		cond = "(" + strings.Join(conds, " OR ") + ")"
+	}
+	return wrap(tags, cond), nil
+}
+
+func (c *Compiler) has(t Term) (string, error) {
+	if t.Op != OpEq {
+		return "", fmt.Errorf("has: does not support %s", t.Op)
+	}
+	conds := make([]string, len(t.Values))
+	for i, key := range t.Values {
+		if !validKey(key) {
+			return "", fmt.Errorf("invalid key %q", key)
+		}
+		field, err := c.field(key)
+		if err != nil {
+			return "", err
+		}
+		conds[i] = wrap(field, field.Column+" IS NOT NULL")
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", nil
+}
+
+func (c *Compiler) compare(field Field, t Term, kind Kind) (string, error) {
+	var cond string
+	var err error
+	switch kind {
+	case KindNumber:
+		cond, err = c.compareNumber(field.Column, t)
+	case KindTime:
+		cond, err = c.compareTime(field.Column, t)
+	case KindUser:
+		cond, err = c.compareUser(field.Column, t)
+	case KindJSON:
+		if t.Op != OpEq {
+			column := fmt.Sprintf("CASE WHEN %[1]s ~ '^-?[0-9]+(\\.[0-9]+)?$' THEN (%[1]s)::numeric END", field.Column)
+			cond, err = c.compareNumber(column, t)
+		} else {
+			cond, err = c.compareText(field.Column, t, false)
+		}
+	default:
+		cond, err = c.compareText(field.Column, t, kind == KindContains)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", t.Key, err)
+	}
+	return wrap(field, cond), nil
+}
+
+func wrap(field Field, cond string) string {
+	if field.Wrap == "" {
+		return cond
+	}
+	return fmt.Sprintf(field.Wrap, cond)
+}
+
+func (c *Compiler) compareText(column string, t Term, contains bool) (string, error) {
+	if t.Op != OpEq {
+		return "", fmt.Errorf("%s is not supported on text", t.Op)
+	}
+
+	var exact []string
+	var conds []string
+	for _, v := range t.Values {
+		switch {
+		case contains:
+			conds = append(conds, column+" ILIKE "+c.Arg("%"+likePattern(v)+"%"))
+		case strings.Contains(v, "*"):
+			conds = append(conds, column+" ILIKE "+c.Arg(likePattern(v)))
+		default:
+			exact = append(exact, v)
+		}
+	}
+	switch len(exact) {
+	case 0:
+	case 1:
+		conds = append(conds, column+" = "+c.Arg(exact[0]))
+	default:
+		conds = append(conds, column+" = ANY("+c.Arg(pq.Array(exact))+")")
+	}
+
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", nil
+}
+
+func (c *Compiler) compareNumber(column string, t Term) (string, error) {
+	values := make([]float64, len(t.Values))
+	for i, v := range t.Values {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a number", v)
+		}
+		values[i] = n
+	}
+
+	if len(values) > 1 {
+		return column + " = ANY(" + c.Arg(pq.Array(values)) + "::numeric[])", nil
+	}
+	return fmt.Sprintf("%s %s %s::numeric", column, t.Op, c.Arg(values[0])), nil
+}
+
+func (c *Compiler) compareTime(column string, t Term) (string, error) {
+	if len(t.Values) != 1 {
+		return "", fmt.Errorf("lists are not supported on times")
+	}
+
+	now := c.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	value, day, relative, err := parseTime(t.Values[0], now)
+	if err != nil {
+		return "", err
+	}
+
+	if t.Op != OpEq {
+		return fmt.Sprintf("%s %s %s", column, t.Op, c.Arg(value)), nil
+	}
+	switch {
+	case relative:
+		// last_seen:-24h reads as "within the last 24 hours"
+		return column + " >= " + c.Arg(value), nil
+	case day:
+		return fmt.Sprintf("(%s >= %s AND %s < %s)", column, c.Arg(value), column, c.Arg(value.AddDate(0, 0, 1))), nil
+	}
+	return column + " = " + c.Arg(value), nil
+}
+
+func (c *Compiler) compareUser(column string, t Term) (string, error) {
+	if t.Op != OpEq {
+		return "", fmt.Errorf("%s is not supported on users", t.Op)
+	}
+
+	var ids []string
+	var conds []string
+	for _, v := range t.Values {
+		switch v {
+		case "none":
+			conds = append(conds, column+" IS NULL")
+		case "me":
+			ids = append(ids, c.UserID)
+		default:
+			ids = append(ids, v)
+		}
+	}
+	if len(ids) > 0 {
+		conds = append(conds, column+" = ANY("+c.Arg(pq.Array(ids))+")")
+	}
+
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", nil
+}
+
+// parseTime reads an RFC 3339 timestamp, a 2006-01-02 date or a relative
+// time such as -30m, -24h or -7d.
+func parseTime(v string, now time.Time) (value time.Time, day bool, relative bool, err error) {
+	if strings.HasPrefix(v, "-") && len(v) > 2 {
+		unit := v[len(v)-1]
+		n, convErr := strconv.Atoi(v[1 : len(v)-1])
+		if convErr == nil && n >= 0 {
+			switch unit {
+			case 'm':
+				return now.Add(-time.Duration(n) * time.Minute), false, true, nil
+			case 'h':
+				return now.Add(-time.Duration(n) * time.Hour), false, true, nil
+			case 'd':
+				return now.AddDate(0, 0, -n), false, true, nil
+			case 'w':
+				return now.AddDate(0, 0, -7*n), false, true, nil
+			}
+		}
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, false, nil
+	}
+	return time.Time{}, false, false, fmt.Errorf("%q is not a time", v)
+}
+
+// likePattern escapes LIKE wildcards in v and turns * into %.
+func likePattern(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(v)
+	return strings.ReplaceAll(v, "*", "%")
+}
+
+// JSONProperty returns a Schema.Property resolving keys to paths inside the
+// JSONB column, so runtime.name reads column #>> '{runtime,name}'.
+func JSONProperty(column string, wrapper string) func([]string, func(interface{}) string) Field {
+	return func(path []string, arg func(interface{}) string) Field {
+		return Field{
+			Column: fmt.Sprintf("(%s #>> %s::text[])", column, arg(pq.Array(path))),
+			Kind:   KindJSON,
+			Wrap:   wrapper,
+		}
+	}
+}
@@ -0,0 +1,385 @@
+// Package query parses search box queries such as
+//
+//	level:error is:unresolved last_seen:-24h runtime.name:python -os.name:windows "timeout"
+//
+// and compiles them into parameterized SQL conditions.
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the comparison a term makes.
+type Op string
+
+const (
+	OpEq  Op = "="
+	OpGt  Op = ">"
+	OpGte Op = ">="
+	OpLt  Op = "<"
+	OpLte Op = "<="
+)
+
+// Node is a parsed query expression.
+type Node interface {
+	node()
+}
+
+// And matches when every node matches.
+type And struct {
+	Nodes []Node
+}
+
+// Or matches when any node matches.
+type Or struct {
+	Nodes []Node
+}
+
+// Not matches when its node does not.
+type Not struct {
+	Node Node
+}
+
+// Term is a single key:value filter. Free text has an empty Key.
+type Term struct {
+	Key    string
+	Op     Op
+	Values []string
+}
+
+func (And) node()  {}
+func (Or) node()   {}
+func (Not) node()  {}
+func (Term) node() {}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// Parse parses a query. An empty query yields a nil Node.
+//
+// Terms are joined with AND unless separated by OR, AND binds tighter than OR
+// and parentheses group. A term is negated with a leading - or ! or with NOT.
+// Values may be quoted, compared with key:>value, key:>=value, key:<value or
+// key:<=value, and listed as key:[a,b] or key:[a, b].
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return node, nil
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		ch := input[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case (ch == '-' || ch == '!') && i+1 < len(input) && input[i+1] == '(':
+			tokens = append(tokens, token{tokenNot, string(ch), i})
+			i++
+		default:
+			start := i
+			quoted := false
+			// Lists may have spaces after their commas, as in env:[prod, staging]
+			inList := false
+			for i < len(input) {
+				c := input[i]
+				if c == '\\' && quoted && i+1 < len(input) {
+					i += 2
+					continue
+				}
+				if c == '"' {
+					quoted = !quoted
+				} else if !quoted && c == '[' && i > start && strings.IndexByte(":=<>", input[i-1]) >= 0 {
+					inList = true
+				} else if !quoted && c == ']' {
+					inList = false
+				} else if !quoted && !inList && (c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ')') {
+					break
+				}
+				i++
+			}
+			if quoted {
+				return nil, fmt.Errorf("unterminated quote at position %d", start)
+			}
+			if inList {
+				return nil, fmt.Errorf("missing ] for list at position %d", start)
+			}
+
+			text := input[start:i]
+			kind := tokenTerm
+			switch text {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			tokens = append(tokens, token{kind, text, start})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseOr() (Node, error) {
+	var nodes []Node
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if t, ok := p.peek(); !ok || t.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var nodes []Node
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokenOr || t.kind == tokenRParen {
+			break
+		}
+		if t.kind == tokenAnd {
+			if len(nodes) == 0 {
+				return nil, fmt.Errorf("unexpected AND at position %d", t.pos)
+			}
+			p.pos++
+		}
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	switch len(nodes) {
+	case 0:
+		if t, ok := p.peek(); ok {
+			return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+		}
+		return nil, fmt.Errorf("unexpected end of query")
+	case 1:
+		return nodes[0], nil
+	}
+	return And{Nodes: nodes}, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	switch t.kind {
+	case tokenNot:
+		p.pos++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: node}, nil
+	case tokenLParen:
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next.kind != tokenRParen {
+			return nil, fmt.Errorf("missing ) for ( at position %d", t.pos)
+		}
+		p.pos++
+		return node, nil
+	case tokenTerm:
+		p.pos++
+		return parseTerm(t)
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func parseTerm(t token) (Node, error) {
+	text := t.text
+	negated := false
+	if len(text) > 1 && (text[0] == '-' || text[0] == '!') {
+		negated = true
+		text = text[1:]
+	}
+
+	term := Term{Op: OpEq}
+	if colon := unquotedIndex(text, ':'); colon > 0 {
+		term.Key = text[:colon]
+		if !validKey(term.Key) {
+			return nil, fmt.Errorf("invalid key %q at position %d", term.Key, t.pos)
+		}
+		text = text[colon+1:]
+		for _, op := range []Op{OpGte, OpLte, OpGt, OpLt} {
+			if strings.HasPrefix(text, string(op)) {
+				term.Op = op
+				text = text[len(op):]
+				break
+			}
+		}
+	}
+
+	values, err := parseValues(text)
+	if err != nil {
+		return nil, fmt.Errorf("%v at position %d", err, t.pos)
+	}
+	if term.Op != OpEq && len(values) != 1 {
+		return nil, fmt.Errorf("%s needs a single value at position %d", term.Op, t.pos)
+	}
+	term.Values = values
+
+	if negated {
+		return Not{Node: term}, nil
+	}
+	return term, nil
+}
+
+// parseValues reads a bare or quoted value, or a [a,b] list of them.
+func parseValues(text string) ([]string, error) {
+	if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") && len(text) > 1 {
+		var values []string
+		for _, part := range splitUnquoted(text[1:len(text)-1], ',') {
+			v, err := unquote(strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			if v == "" {
+				return nil, fmt.Errorf("empty value in list")
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+
+	v, err := unquote(text)
+	if err != nil {
+		return nil, err
+	}
+	if v == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	return []string{v}, nil
+}
+
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", fmt.Errorf("badly quoted value %s", s)
+	}
+
+	var b strings.Builder
+	body := s[1 : len(s)-1]
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' && i+1 < len(body) {
+			i++
+		} else if body[i] == '"' {
+			return "", fmt.Errorf("badly quoted value %s", s)
+		}
+		b.WriteByte(body[i])
+	}
+	return b.String(), nil
+}
+
+func unquotedIndex(s string, sep byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	for {
+		i := unquotedIndex(s, sep)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// validKey allows letters, digits, _ and - in dot separated segments.
+func validKey(key string) bool {
+	for _, segment := range strings.Split(key, ".") {
+		if segment == "" {
+			return false
+		}
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
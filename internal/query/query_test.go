@@ -0,0 +1,225 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Node
+	}{
+		{``, nil},
+		{`timeout`, Term{Op: OpEq, Values: []string{"timeout"}}},
+		{`level:error`, Term{Key: "level", Op: OpEq, Values: []string{"error"}}},
+		{`"connection reset"`, Term{Op: OpEq, Values: []string{"connection reset"}}},
+		{`message:"say \"hi\" (twice)"`, Term{Key: "message", Op: OpEq, Values: []string{`say "hi" (twice)`}}},
+		{`path:"C:\\temp"`, Term{Key: "path", Op: OpEq, Values: []string{`C:\temp`}}},
+		{`"key:value"`, Term{Op: OpEq, Values: []string{"key:value"}}},
+		{`count:>=10`, Term{Key: "count", Op: OpGte, Values: []string{"10"}}},
+		{`count:<5`, Term{Key: "count", Op: OpLt, Values: []string{"5"}}},
+		{`env:[prod,staging]`, Term{Key: "env", Op: OpEq, Values: []string{"prod", "staging"}}},
+		{`env:[prod, staging]`, Term{Key: "env", Op: OpEq, Values: []string{"prod", "staging"}}},
+		{`env:[ prod ,  "a, b" ] level:error`, And{Nodes: []Node{
+			Term{Key: "env", Op: OpEq, Values: []string{"prod", "a, b"}},
+			Term{Key: "level", Op: OpEq, Values: []string{"error"}},
+		}}},
+		{`-level:error`, Not{Node: Term{Key: "level", Op: OpEq, Values: []string{"error"}}}},
+		{`!level:error`, Not{Node: Term{Key: "level", Op: OpEq, Values: []string{"error"}}}},
+		{`NOT level:error`, Not{Node: Term{Key: "level", Op: OpEq, Values: []string{"error"}}}},
+		{`-(a OR b)`, Not{Node: Or{Nodes: []Node{
+			Term{Op: OpEq, Values: []string{"a"}},
+			Term{Op: OpEq, Values: []string{"b"}},
+		}}}},
+		{`NOT NOT a`, Not{Node: Not{Node: Term{Op: OpEq, Values: []string{"a"}}}}},
+		{`a b OR c`, Or{Nodes: []Node{
+			And{Nodes: []Node{Term{Op: OpEq, Values: []string{"a"}}, Term{Op: OpEq, Values: []string{"b"}}}},
+			Term{Op: OpEq, Values: []string{"c"}},
+		}}},
+		{`a OR b AND c`, Or{Nodes: []Node{
+			Term{Op: OpEq, Values: []string{"a"}},
+			And{Nodes: []Node{Term{Op: OpEq, Values: []string{"b"}}, Term{Op: OpEq, Values: []string{"c"}}}},
+		}}},
+		{`a (b OR c)`, And{Nodes: []Node{
+			Term{Op: OpEq, Values: []string{"a"}},
+			Or{Nodes: []Node{Term{Op: OpEq, Values: []string{"b"}}, Term{Op: OpEq, Values: []string{"c"}}}},
+		}}},
+		{`(a)`, Term{Op: OpEq, Values: []string{"a"}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`level:"error`, "unterminated quote at position 0"},
+		{`a message:"oops`, "unterminated quote at position 2"},
+		{`a env:[prod, staging`, "missing ] for list at position 2"},
+		{`a (b OR c`, "missing ) for ( at position 2"},
+		{`a b)`, `unexpected ")" at position 3`},
+		{`AND a`, "unexpected AND at position 0"},
+		{`a OR`, "unexpected end of query"},
+		{`a OR OR b`, `unexpected "OR" at position 5`},
+		{`a b$c:d`, `invalid key "b$c" at position 2`},
+		{`a level:`, "missing value at position 2"},
+		{`env:[prod,,staging]`, "empty value in list at position 0"},
+		{`count:>[1,2]`, "> needs a single value at position 0"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want %q", tt.input, tt.want)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("Parse(%q) error = %q, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+var testSchema = &Schema{
+	Fields: map[string]Field{
+		"level":     {Column: "i.level"},
+		"count":     {Column: "i.event_count", Kind: KindNumber},
+		"last_seen": {Column: "i.last_seen_at", Kind: KindTime},
+		"assigned":  {Column: "i.assignee_id", Kind: KindUser},
+		"message":   {Column: "i.message", Kind: KindContains},
+		"release":   {Column: "e.release", Wrap: "EXISTS (SELECT 1 FROM events e WHERE e.issue_id = i.id AND %s)"},
+		"version":   {Column: "(i.properties ->> 'version')", Kind: KindJSON},
+	},
+	FreeText: Field{Column: "i.message"},
+	Is: map[string]string{
+		"unresolved": "i.status = 'unresolved'",
+		"resolved":   "i.status = 'resolved'",
+	},
+	Tags: &Field{Column: "i.tags"},
+}
+
+func TestCompile(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		input string
+		sql   string
+		args  []interface{}
+	}{
+		// Text
+		{`level:error`, `i.level = $1`, []interface{}{"error"}},
+		{`level:[error, fatal]`, `i.level = ANY($1)`, []interface{}{pq.Array([]string{"error", "fatal"})}},
+		{`level:err*`, `i.level ILIKE $1`, []interface{}{"err%"}},
+		{`level:[err*,fatal]`, `(i.level ILIKE $1 OR i.level = $2)`, []interface{}{"err%", "fatal"}},
+		{`level:"100%_done*"`, `i.level ILIKE $1`, []interface{}{`100\%\_done%`}},
+		{`"conn reset"`, `i.message ILIKE $1`, []interface{}{"%conn reset%"}},
+		{`message:a_b`, `i.message ILIKE $1`, []interface{}{`%a\_b%`}},
+		{`release:1.0`, `EXISTS (SELECT 1 FROM events e WHERE e.issue_id = i.id AND e.release = $1)`, []interface{}{"1.0"}},
+
+		// Number
+		{`count:10`, `i.event_count = $1::numeric`, []interface{}{10.0}},
+		{`count:>=2.5`, `i.event_count >= $1::numeric`, []interface{}{2.5}},
+		{`count:[1,2]`, `i.event_count = ANY($1::numeric[])`, []interface{}{pq.Array([]float64{1, 2})}},
+
+		// Time
+		{`last_seen:-24h`, `i.last_seen_at >= $1`, []interface{}{now.Add(-24 * time.Hour)}},
+		{`last_seen:-7d`, `i.last_seen_at >= $1`, []interface{}{now.AddDate(0, 0, -7)}},
+		{`last_seen:<-30m`, `i.last_seen_at < $1`, []interface{}{now.Add(-30 * time.Minute)}},
+		{`last_seen:2026-03-01`, `(i.last_seen_at >= $1 AND i.last_seen_at < $2)`, []interface{}{
+			time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		}},
+		{`last_seen:>2026-03-01T08:00:00Z`, `i.last_seen_at > $1`, []interface{}{time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)}},
+		{`last_seen:2026-03-01T08:00:00Z`, `i.last_seen_at = $1`, []interface{}{time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)}},
+
+		// User
+		{`assigned:me`, `i.assignee_id = ANY($1)`, []interface{}{pq.Array([]string{"usr_me"})}},
+		{`assigned:none`, `i.assignee_id IS NULL`, nil},
+		{`assigned:[none,me,usr_b]`, `(i.assignee_id IS NULL OR i.assignee_id = ANY($1))`, []interface{}{pq.Array([]string{"usr_me", "usr_b"})}},
+
+		// Tags
+		{`tags.browser:Chrome`, `i.tags @> $1::jsonb`, []interface{}{`{"browser":"Chrome"}`}},
+		{`tags.os.name:[linux,"mac os"]`, `(i.tags @> $1::jsonb OR i.tags @> $2::jsonb)`, []interface{}{`{"os.name":"linux"}`, `{"os.name":"mac os"}`}},
+		{`tags.browser:Chrom*`, `(i.tags ->> $1::text) ILIKE $2`, []interface{}{"browser", "Chrom%"}},
+
+		// is:, has: and JSON properties
+		{`is:[unresolved,resolved]`, `(i.status = 'unresolved' OR i.status = 'resolved')`, nil},
+		{`has:level`, `(i.level IS NOT NULL)`, nil},
+		{`version:1.2`, `(i.properties ->> 'version') = $1`, []interface{}{"1.2"}},
+		{`version:>=2`, `CASE WHEN (i.properties ->> 'version') ~ '^-?[0-9]+(\.[0-9]+)?$' THEN ((i.properties ->> 'version'))::numeric END >= $1::numeric`, []interface{}{2.0}},
+
+		// Boolean structure
+		{`-level:error`, `NOT COALESCE(i.level = $1, FALSE)`, []interface{}{"error"}},
+		{`level:error OR count:>1 is:unresolved`, `(i.level = $1 OR (i.event_count > $2::numeric AND (i.status = 'unresolved')))`, []interface{}{"error", 1.0}},
+		{`(level:error OR level:fatal) NOT is:resolved`, `((i.level = $1 OR i.level = $2) AND NOT COALESCE((i.status = 'resolved'), FALSE))`, []interface{}{"error", "fatal"}},
+	}
+	for _, tt := range tests {
+		node, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.input, err)
+			continue
+		}
+
+		var args []interface{}
+		c := &Compiler{
+			Schema: testSchema,
+			Arg: func(v interface{}) string {
+				args = append(args, v)
+				return fmt.Sprintf("$%d", len(args))
+			},
+			UserID: "usr_me",
+			Now:    now,
+		}
+		sql, err := c.Compile(node)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if sql != tt.sql {
+			t.Errorf("Compile(%q) = %s, want %s", tt.input, sql, tt.sql)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("Compile(%q) args = %#v, want %#v", tt.input, args, tt.args)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`nope:1`, `unknown key "nope"`},
+		{`is:bogus`, "unknown filter is:bogus"},
+		{`count:abc`, `count: "abc" is not a number`},
+		{`level:>a`, "level: > is not supported on text"},
+		{`last_seen:yesterday`, `last_seen: "yesterday" is not a time`},
+		{`last_seen:[-1h,-2h]`, "last_seen: lists are not supported on times"},
+		{`assigned:>me`, "assigned: > is not supported on users"},
+		{`tags.browser:>1`, "tags.browser: > is not supported on tags"},
+	}
+	for _, tt := range tests {
+		node, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.input, err)
+			continue
+		}
+		c := &Compiler{Schema: testSchema, Arg: func(interface{}) string { return "?" }}
+		_, err = c.Compile(node)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) error = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Package sourcemap reads version 3 source maps and maps positions in
+// generated JavaScript back to the original sources.
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Position is a place in an original source. Line and Column are zero based.
+type Position struct {
+	Source string
+	Line   int
+	Column int
+	Name   string
+}
+
+type mapping struct {
+	genLine   int
+	genColumn int
+	source    int
+	line      int
+	column    int
+	name      int
+}
+
+// Map is a parsed source map. It is safe for concurrent use.
+type Map struct {
+	sources  []string
+	contents []*string
+	names    []string
+	mappings []mapping
+
+	mu    sync.Mutex
+	lines map[int][]string
+}
+
+type rawMap struct {
+	Version        int          `json:"version"`
+	SourceRoot     string       `json:"sourceRoot"`
+	Sources        []string     `json:"sources"`
+	SourcesContent []*string    `json:"sourcesContent"`
+	Names          []string     `json:"names"`
+	Mappings       string       `json:"mappings"`
+	Sections       []rawSection `json:"sections"`
+}
+
+type rawSection struct {
+	Offset struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"offset"`
+	Map *rawMap `json:"map"`
+}
+
+// Parse reads a source map, including index maps with embedded sections.
+func Parse(data []byte) (*Map, error) {
+	// Maps may start with an XSSI guard line
+	if bytes.HasPrefix(data, []byte(")]}")) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	var raw rawMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid source map: %w", err)
+	}
+	if raw.Version != 3 {
+		return nil, fmt.Errorf("unsupported source map version %d", raw.Version)
+	}
+
+	m := &Map{lines: make(map[int][]string)}
+	if len(raw.Sections) > 0 {
+		for _, section := range raw.Sections {
+			if section.Map == nil {
+				return nil, errors.New("index map sections must embed their map")
+			}
+			if err := m.add(section.Map, section.Offset.Line, section.Offset.Column); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := m.add(&raw, 0, 0); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(m.mappings, func(i, j int) bool {
+		a, b := m.mappings[i], m.mappings[j]
+		if a.genLine != b.genLine {
+			return a.genLine < b.genLine
+		}
+		return a.genColumn < b.genColumn
+	})
+	return m, nil
+}
+
+// add appends a map's sources and mappings, shifted by a section offset.
+func (m *Map) add(raw *rawMap, lineOffset, columnOffset int) error {
+	sourceBase := len(m.sources)
+	nameBase := len(m.names)
+
+	for i, source := range raw.Sources {
+		if raw.SourceRoot != "" && !strings.Contains(source, "://") && !strings.HasPrefix(source, "/") {
+			source = strings.TrimSuffix(raw.SourceRoot, "/") + "/" + source
+		}
+		m.sources = append(m.sources, source)
+
+		var content *string
+		if i < len(raw.SourcesContent) {
+			content = raw.SourcesContent[i]
+		}
+		m.contents = append(m.contents, content)
+	}
+	m.names = append(m.names, raw.Names...)
+
+	mappings, err := decodeMappings(raw.Mappings)
+	if err != nil {
+		return err
+	}
+	for _, mp := range mappings {
+		if mp.genLine == 0 {
+			mp.genColumn += columnOffset
+		}
+		mp.genLine += lineOffset
+		if mp.source >= 0 {
+			if mp.source >= len(raw.Sources) {
+				return errors.New("mapping refers to an unknown source")
+			}
+			mp.source += sourceBase
+		}
+		if mp.name >= 0 {
+			if mp.name >= len(raw.Names) {
+				return errors.New("mapping refers to an unknown name")
+			}
+			mp.name += nameBase
+		}
+		m.mappings = append(m.mappings, mp)
+	}
+	return nil
+}
+
+// decodeMappings decodes the base64 VLQ "mappings" field.
+func decodeMappings(s string) ([]mapping, error) {
+	var out []mapping
+	var genLine, genColumn, source, line, column, name int
+
+	for _, group := range strings.Split(s, ";") {
+		genColumn = 0
+		for _, segment := range strings.Split(group, ",") {
+			if segment == "" {
+				continue
+			}
+			values, err := decodeVLQ(segment)
+			if err != nil {
+				return nil, err
+			}
+
+			genColumn += values[0]
+			if genColumn < 0 {
+				return nil, fmt.Errorf("mapping segment %q has a negative column", segment)
+			}
+			mp := mapping{genLine: genLine, genColumn: genColumn, source: -1, name: -1}
+			switch len(values) {
+			case 1:
+			case 4, 5:
+				source += values[1]
+				line += values[2]
+				column += values[3]
+				if source < 0 || line < 0 || column < 0 {
+					return nil, fmt.Errorf("mapping segment %q points before the start of a source", segment)
+				}
+				mp.source, mp.line, mp.column = source, line, column
+				if len(values) == 5 {
+					name += values[4]
+					if name < 0 {
+						return nil, fmt.Errorf("mapping segment %q refers to a negative name", segment)
+					}
+					mp.name = name
+				}
+			default:
+				return nil, fmt.Errorf("invalid mapping segment %q", segment)
+			}
+			out = append(out, mp)
+		}
+		genLine++
+	}
+	return out, nil
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func decodeVLQ(segment string) ([]int, error) {
+	var values []int
+	value, shift := 0, 0
+	for i := 0; i < len(segment); i++ {
+		digit := strings.IndexByte(base64Chars, segment[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid mapping character %q", segment[i])
+		}
+
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			if shift > 30 {
+				return nil, errors.New("mapping value overflows")
+			}
+			continue
+		}
+
+		if value&1 != 0 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 {
+		return nil, errors.New("truncated mapping segment")
+	}
+	return values, nil
+}
+
+// Lookup maps a zero based line and column of the generated file to the
+// original source, using the closest mapping at or before the column.
+func (m *Map) Lookup(line, column int) (Position, bool) {
+	i := sort.Search(len(m.mappings), func(i int) bool {
+		mp := m.mappings[i]
+		return mp.genLine > line || (mp.genLine == line && mp.genColumn > column)
+	})
+	if i == 0 {
+		return Position{}, false
+	}
+
+	mp := m.mappings[i-1]
+	if mp.genLine != line || mp.source < 0 {
+		return Position{}, false
+	}
+
+	pos := Position{Source: m.sources[mp.source], Line: mp.line, Column: mp.column}
+	if mp.name >= 0 {
+		pos.Name = m.names[mp.name]
+	}
+	return pos, true
+}
+
+// SourceLines returns the embedded content of a source split into lines, or
+// nil if the map doesn't carry it.
+func (m *Map) SourceLines(source string) []string {
+	for i, s := range m.sources {
+		if s != source || m.contents[i] == nil {
+			continue
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if lines, ok := m.lines[i]; ok {
+			return lines
+		}
+		lines := strings.Split(strings.ReplaceAll(*m.contents[i], "\r\n", "\n"), "\n")
+		m.lines[i] = lines
+		return lines
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package sourcemap
+
+import "testing"
+
+func TestParseRejectsNegativePositions(t *testing.T) {
+	maps := []string{
+		// Original line -1
+		`{"version":3,"sources":["a.js"],"sourcesContent":["x"],"mappings":"AADD"}`,
+		// Source index -1
+		`{"version":3,"sources":["a.js"],"mappings":"ADAA"}`,
+		// Name index -1
+		`{"version":3,"sources":["a.js"],"names":["f"],"mappings":"AAAAD"}`,
+		// Generated column -1
+		`{"version":3,"sources":["a.js"],"mappings":"DAAA"}`,
+	}
+	for _, data := range maps {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	m, err := Parse([]byte(`{"version":3,"sources":["a.js"],"sourcesContent":["one\ntwo"],"names":["f"],"mappings":"AAAA,EACEA"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, ok := m.Lookup(0, 3)
+	if !ok || pos.Source != "a.js" || pos.Line != 1 || pos.Column != 2 || pos.Name != "f" {
+		t.Fatalf("Lookup(0, 3) = %+v, %v", pos, ok)
+	}
+	if lines := m.SourceLines(pos.Source); len(lines) != 2 || lines[pos.Line] != "two" {
+		t.Fatalf("SourceLines = %q", lines)
+	}
+}
@@ -1 +1,7 @@
 package utils
+
+// DSNCachePrefix namespaces the Redis keys caching DSN token lookups.
+const DSNCachePrefix = "dsn:"
+
+// LoginAttemptsPrefix namespaces the Redis counters of failed logins.
+const LoginAttemptsPrefix = "login_attempts:"
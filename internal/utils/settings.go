@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GetSetting decodes the JSON value of a setting into dest.
+func GetSetting(db sqlx.Queryer, key string, dest interface{}) error {
+	var raw []byte
+	if err := sqlx.Get(db, &raw, "SELECT value FROM settings WHERE key = $1", key); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+// SettingEnabled reads a boolean setting, or fallback if it is missing or
+// not a boolean.
+func SettingEnabled(db sqlx.Queryer, key string, fallback bool) bool {
+	var enabled bool
+	if err := GetSetting(db, key, &enabled); err != nil {
+		return fallback
+	}
+	return enabled
+}
+
+// SiteName is the org.siteName setting, used to sign emails.
+func SiteName(db sqlx.Queryer) string {
+	name := "Unbit"
+	GetSetting(db, "org.siteName", &name)
+	return name
+}
+
+// SiteLink builds an absolute link to a page of the app from the
+// org.rootUrl setting, for links sent in emails.
+func SiteLink(db sqlx.Queryer, path string, params url.Values) string {
+	root := ""
+	GetSetting(db, "org.rootUrl", &root)
+	link := strings.TrimSuffix(root, "/") + path
+	if len(params) > 0 {
+		link += "?" + params.Encode()
+	}
+	return link
+}
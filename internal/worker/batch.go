@@ -0,0 +1,577 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/santoshkpatro/unbit/internal/models"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+// batchEvent is one decoded delivery on its way into the database.
+type batchEvent struct {
+	msg         Message
+	id          string
+	project     projectConfig
+	event       models.Event
+	fingerprint string
+	issueID     string
+}
+
+type issueKey struct {
+	projectID   string
+	fingerprint string
+}
+
+// issueSummary is what a batch adds to one issue: how many events, when they
+// happened, the level, type and message of the latest one and the releases
+// of the earliest and latest events that had one.
+type issueSummary struct {
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+	level     string
+	typ       string
+	message   string
+
+	firstRelease     string
+	firstReleaseSeen time.Time
+	lastRelease      string
+	lastReleaseSeen  time.Time
+}
+
+func (s *issueSummary) add(event models.Event) {
+	if s.count == 0 || event.Timestamp.Before(s.firstSeen) {
+		s.firstSeen = event.Timestamp
+	}
+	if s.count == 0 || !event.Timestamp.Before(s.lastSeen) {
+		s.lastSeen = event.Timestamp
+		s.level = event.Properties.Level
+		s.typ = event.Properties.Type
+		s.message = event.Properties.Message
+	}
+	if release := event.Properties.Release; release != "" {
+		s.addRelease(release, event.Timestamp, release, event.Timestamp)
+	}
+	s.count++
+}
+
+func (s *issueSummary) addRelease(first string, firstSeen time.Time, last string, lastSeen time.Time) {
+	if s.firstRelease == "" || firstSeen.Before(s.firstReleaseSeen) {
+		s.firstRelease, s.firstReleaseSeen = first, firstSeen
+	}
+	if s.lastRelease == "" || !lastSeen.Before(s.lastReleaseSeen) {
+		s.lastRelease, s.lastReleaseSeen = last, lastSeen
+	}
+}
+
+func (s *issueSummary) merge(o *issueSummary) {
+	if o.firstSeen.Before(s.firstSeen) {
+		s.firstSeen = o.firstSeen
+	}
+	if !o.lastSeen.Before(s.lastSeen) {
+		s.lastSeen = o.lastSeen
+		s.level, s.typ, s.message = o.level, o.typ, o.message
+	}
+	if o.firstRelease != "" {
+		s.addRelease(o.firstRelease, o.firstReleaseSeen, o.lastRelease, o.lastReleaseSeen)
+	}
+	s.count += o.count
+}
+
+func (s *issueSummary) args() []interface{} {
+	return []interface{}{s.count, s.firstSeen, s.lastSeen, s.level, s.typ, s.message,
+		nullString(s.firstRelease), nullString(s.lastRelease)}
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// issueSummaryUpdate folds a batch summary (EXCLUDED or a VALUES row) into an
+// issue row, keeping the level, type and message of the latest event. The
+// first release sticks once set, the last one follows the latest events.
+func issueSummaryUpdate(table, src string) string {
+	latest := fmt.Sprintf("%[2]s.last_seen_at::timestamptz >= COALESCE(%[1]s.last_seen_at, %[2]s.last_seen_at::timestamptz)", table, src)
+	return fmt.Sprintf(`event_count = %[1]s.event_count + %[2]s.event_count::bigint,
+				first_seen_at = LEAST(%[1]s.first_seen_at, %[2]s.first_seen_at::timestamptz),
+				last_seen_at = GREATEST(%[1]s.last_seen_at, %[2]s.last_seen_at::timestamptz),
+				level = CASE WHEN %[3]s THEN %[2]s.level ELSE %[1]s.level END,
+				type = CASE WHEN %[3]s THEN %[2]s.type ELSE %[1]s.type END,
+				message = CASE WHEN %[3]s THEN %[2]s.message ELSE %[1]s.message END,
+				first_release = COALESCE(%[1]s.first_release, %[2]s.first_release),
+				last_release = CASE WHEN %[3]s THEN COALESCE(%[2]s.last_release, %[1]s.last_release) ELSE COALESCE(%[1]s.last_release, %[2]s.last_release) END,
+				updated_at = NOW()`, table, src, latest)
+}
+
+// handleBatch persists a batch of events in a single transaction: one
+// multi-row update of the existing issues carrying the merged event counts
+// and last seen details, one multi-row insert of new issues, one multi-row
+// event insert and one project counter update. Existing issues are locked in
+// id order before any of them is written, and rows are written in a stable
+// order, so concurrent batches lock issues and projects in the same order.
+// Events already stored by an earlier delivery are skipped.
+func handleBatch(ctx context.Context, db *sqlx.DB, events []*batchEvent) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback() // no-op if Commit succeeds
+
+	events, err = skipStoredEvents(ctx, tx, events)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	summaries := make(map[issueKey]*issueSummary)
+	projectCounts := make(map[string]int)
+	for _, be := range events {
+		be.fingerprint = ComputeFingerprint(be.event.Properties, be.project.grouping())
+		k := issueKey{be.project.ID, be.fingerprint}
+		if summaries[k] == nil {
+			summaries[k] = &issueSummary{}
+		}
+		summaries[k].add(be.event)
+		projectCounts[be.project.ID]++
+	}
+
+	keys := make([]issueKey, 0, len(summaries))
+	for k := range summaries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].projectID != keys[j].projectID {
+			return keys[i].projectID < keys[j].projectID
+		}
+		return keys[i].fingerprint < keys[j].fingerprint
+	})
+
+	// Fingerprints merged into another issue resolve to it through issue_aliases
+	issueIDs, err := resolveIssues(ctx, tx, keys)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]*issueSummary)
+	var fresh []issueKey
+	for _, k := range keys {
+		id, ok := issueIDs[k]
+		if !ok {
+			fresh = append(fresh, k)
+			continue
+		}
+		if existing[id] == nil {
+			existing[id] = &issueSummary{}
+			*existing[id] = *summaries[k]
+		} else {
+			existing[id].merge(summaries[k])
+		}
+	}
+
+	if len(existing) > 0 {
+		ids := make([]string, 0, len(existing))
+		for id := range existing {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		if _, err := tx.ExecContext(ctx, `
+			SELECT id FROM issues WHERE id = ANY($1) ORDER BY id FOR UPDATE
+		`, pq.Array(ids)); err != nil {
+			return fmt.Errorf("lock issues: %w", err)
+		}
+
+		args := make([]interface{}, 0, len(ids)*9)
+		for _, id := range ids {
+			args = append(args, id)
+			args = append(args, existing[id].args()...)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE issues i
+			SET `+issueSummaryUpdate("i", "v")+`
+			FROM (VALUES `+placeholders(len(ids), 9)+`) AS v(id, event_count, first_seen_at, last_seen_at, level, type, message, first_release, last_release)
+			WHERE i.id = v.id
+		`, args...); err != nil {
+			return fmt.Errorf("bump issues: %w", err)
+		}
+	}
+
+	// Insert new issues. One created by a concurrent batch since they were
+	// looked up is bumped instead.
+	if len(fresh) > 0 {
+		issueArgs := make([]interface{}, 0, len(fresh)*11)
+		for _, k := range fresh {
+			issueArgs = append(issueArgs, utils.GenerateID("isu"), k.projectID, k.fingerprint)
+			issueArgs = append(issueArgs, summaries[k].args()...)
+		}
+		rows, err := tx.QueryxContext(ctx, `
+			INSERT INTO issues (id, project_id, fingerprint, event_count, first_seen_at, last_seen_at, level, type, message, first_release, last_release)
+			VALUES `+placeholders(len(fresh), 11)+`
+			ON CONFLICT (project_id, fingerprint)
+			DO UPDATE SET `+issueSummaryUpdate("issues", "EXCLUDED")+`
+			RETURNING id, project_id, fingerprint
+		`, issueArgs...)
+		if err != nil {
+			return fmt.Errorf("upsert issues: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			var k issueKey
+			if err := rows.Scan(&id, &k.projectID, &k.fingerprint); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan issue: %w", err)
+			}
+			issueIDs[k] = id
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("upsert issues: %w", err)
+		}
+	}
+
+	// Regressions are blamed on the release of the latest event
+	releases := make(map[string]string)
+	for k, id := range issueIDs {
+		if summaries[k].lastRelease != "" {
+			releases[id] = summaries[k].lastRelease
+		}
+	}
+	if err := reopenIssues(ctx, tx, issueIDs, releases); err != nil {
+		return err
+	}
+
+	// Insert events
+	eventArgs := make([]interface{}, 0, len(events)*8)
+	for _, be := range events {
+		be.issueID = issueIDs[issueKey{be.project.ID, be.fingerprint}]
+		eventArgs = append(eventArgs,
+			be.id, be.issueID, be.event.Timestamp,
+			PropertiesToJSON(be.event.Properties), be.project.ID, "issues", be.fingerprint,
+			nullString(be.event.Properties.Environment),
+		)
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO events (id, issue_id, timestamp, properties, project_id, event_type, fingerprint, environment)
+		VALUES `+placeholders(len(events), 8)+`
+		ON CONFLICT (id) DO NOTHING
+	`, eventArgs...)
+	if err != nil {
+		return fmt.Errorf("insert events: %w", err)
+	}
+	// A concurrent batch stored one of the events first. Rolling back keeps
+	// it from being counted twice, the retry skips it.
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("insert events: %w", err)
+	}
+	if inserted != int64(len(events)) {
+		return fmt.Errorf("insert events: %d of %d events already stored", int64(len(events))-inserted, len(events))
+	}
+
+	if err := countIssueUsers(ctx, tx, events); err != nil {
+		return err
+	}
+	if err := countIssueTags(ctx, tx, events); err != nil {
+		return err
+	}
+	if err := countReleases(ctx, tx, events); err != nil {
+		return err
+	}
+	if err := countEnvironments(ctx, tx, events); err != nil {
+		return err
+	}
+
+	// Bump project counters, once per project
+	projectIDs := make([]string, 0, len(projectCounts))
+	for id := range projectCounts {
+		projectIDs = append(projectIDs, id)
+	}
+	sort.Strings(projectIDs)
+	projectArgs := make([]interface{}, 0, len(projectIDs)*2)
+	for _, id := range projectIDs {
+		projectArgs = append(projectArgs, id, projectCounts[id])
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE projects p
+		SET total_events = p.total_events + v.n::bigint
+		FROM (VALUES `+placeholders(len(projectIDs), 2)+`) AS v(id, n)
+		WHERE p.id = v.id
+	`, projectArgs...); err != nil {
+		return fmt.Errorf("bump project event count: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// reopenIssues flips issues that just received events back to unresolved
+// when they were resolved (a regression) or their ignore period has run out,
+// and logs the change in issue_activities along with the release it
+// happened in.
+func reopenIssues(ctx context.Context, tx *sqlx.Tx, issueIDs map[issueKey]string, releases map[string]string) error {
+	ids := make([]string, 0, len(issueIDs))
+	for _, id := range issueIDs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	rows, err := tx.QueryxContext(ctx, `
+		UPDATE issues i
+		SET status = 'unresolved',
+			is_regression = (i.status = 'resolved'),
+			resolved_at = NULL,
+			ignored_until = NULL,
+			ignored_until_count = NULL,
+			updated_at = NOW()
+		WHERE i.id = ANY($1)
+			AND (
+				i.status = 'resolved'
+				OR (
+					i.status = 'ignored'
+					AND (
+						(i.ignored_until IS NOT NULL AND i.ignored_until <= NOW())
+						OR (i.ignored_until_count IS NOT NULL AND i.event_count >= i.ignored_until_count)
+					)
+				)
+			)
+		RETURNING i.id, i.project_id, i.is_regression
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("reopen issues: %w", err)
+	}
+
+	var activityArgs []interface{}
+	for rows.Next() {
+		var id, projectID string
+		var regression bool
+		if err := rows.Scan(&id, &projectID, &regression); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan reopened issue: %w", err)
+		}
+		kind := "unignored"
+		if regression {
+			kind = "regression"
+		}
+		data := "{}"
+		if release, ok := releases[id]; ok {
+			encoded, _ := json.Marshal(map[string]string{"release": release})
+			data = string(encoded)
+		}
+		activityArgs = append(activityArgs, utils.GenerateID("act"), id, projectID, kind, data)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reopen issues: %w", err)
+	}
+	if len(activityArgs) == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO issue_activities (id, issue_id, project_id, kind, data)
+		VALUES `+placeholders(len(activityArgs)/5, 5), activityArgs...); err != nil {
+		return fmt.Errorf("log reopened issues: %w", err)
+	}
+	return nil
+}
+
+// UserKey identifies the user an event happened to by the most specific
+// field the SDK sent. UserKeySQL computes the same key from events.properties.
+func UserKey(u *models.User) string {
+	switch {
+	case u == nil:
+		return ""
+	case u.ID != "":
+		return "id:" + u.ID
+	case u.Email != "":
+		return "email:" + u.Email
+	case u.Username != "":
+		return "username:" + u.Username
+	case u.IPAddress != "":
+		return "ip:" + u.IPAddress
+	}
+	return ""
+}
+
+const UserKeySQL = `COALESCE(
+	'id:' || NULLIF(properties -> 'user' ->> 'id', ''),
+	'email:' || NULLIF(properties -> 'user' ->> 'email', ''),
+	'username:' || NULLIF(properties -> 'user' ->> 'username', ''),
+	'ip:' || NULLIF(properties -> 'user' ->> 'ipAddress', '')
+)`
+
+// countIssueUsers records which users each issue affected and bumps
+// user_count by the ones not seen before.
+func countIssueUsers(ctx context.Context, tx *sqlx.Tx, events []*batchEvent) error {
+	type issueUser struct{ issueID, key string }
+	seen := make(map[issueUser]bool)
+	var pairs []issueUser
+	for _, be := range events {
+		key := UserKey(be.event.Properties.User)
+		if key == "" {
+			continue
+		}
+		p := issueUser{be.issueID, key}
+		if !seen[p] {
+			seen[p] = true
+			pairs = append(pairs, p)
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].issueID != pairs[j].issueID {
+			return pairs[i].issueID < pairs[j].issueID
+		}
+		return pairs[i].key < pairs[j].key
+	})
+
+	args := make([]interface{}, 0, len(pairs)*2)
+	for _, p := range pairs {
+		args = append(args, p.issueID, p.key)
+	}
+	rows, err := tx.QueryxContext(ctx, `
+		INSERT INTO issue_users (issue_id, user_key)
+		VALUES `+placeholders(len(pairs), 2)+`
+		ON CONFLICT DO NOTHING
+		RETURNING issue_id
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("record issue users: %w", err)
+	}
+
+	newUsers := make(map[string]int)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan issue user: %w", err)
+		}
+		newUsers[id]++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("record issue users: %w", err)
+	}
+	if len(newUsers) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(newUsers))
+	for id := range newUsers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	countArgs := make([]interface{}, 0, len(ids)*2)
+	for _, id := range ids {
+		countArgs = append(countArgs, id, newUsers[id])
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE issues i
+		SET user_count = i.user_count + v.n::bigint
+		FROM (VALUES `+placeholders(len(ids), 2)+`) AS v(id, n)
+		WHERE i.id = v.id
+	`, countArgs...); err != nil {
+		return fmt.Errorf("bump issue user count: %w", err)
+	}
+	return nil
+}
+
+// skipStoredEvents drops events whose id is already in the events table,
+// such as ones delivered again after their batch committed but before it was
+// acknowledged.
+func skipStoredEvents(ctx context.Context, tx *sqlx.Tx, events []*batchEvent) ([]*batchEvent, error) {
+	ids := make([]string, len(events))
+	for i, be := range events {
+		ids[i] = be.id
+	}
+	var stored []string
+	if err := tx.SelectContext(ctx, &stored, `
+		SELECT id FROM events WHERE id = ANY($1)
+	`, pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("find stored events: %w", err)
+	}
+
+	skip := make(map[string]bool, len(stored))
+	for _, id := range stored {
+		skip[id] = true
+	}
+	kept := events[:0:0]
+	for _, be := range events {
+		if skip[be.id] {
+			continue
+		}
+		// The same delivery twice in one batch is stored once too
+		skip[be.id] = true
+		kept = append(kept, be)
+	}
+	return kept, nil
+}
+
+// resolveIssues returns the issues that fingerprints already belong to,
+// following issue_aliases for fingerprints merged into another issue.
+func resolveIssues(ctx context.Context, tx *sqlx.Tx, keys []issueKey) (map[issueKey]string, error) {
+	projectIDs := make([]string, len(keys))
+	fingerprints := make([]string, len(keys))
+	for i, k := range keys {
+		projectIDs[i] = k.projectID
+		fingerprints[i] = k.fingerprint
+	}
+
+	rows, err := tx.QueryxContext(ctx, `
+		SELECT k.project_id, k.fingerprint, COALESCE(a.issue_id, i.id)
+		FROM unnest($1::text[], $2::text[]) AS k(project_id, fingerprint)
+		LEFT JOIN issue_aliases a
+			ON a.project_id = k.project_id AND a.fingerprint = k.fingerprint
+		LEFT JOIN issues i
+			ON i.project_id = k.project_id AND i.fingerprint = k.fingerprint
+		WHERE a.issue_id IS NOT NULL OR i.id IS NOT NULL
+	`, pq.Array(projectIDs), pq.Array(fingerprints))
+	if err != nil {
+		return nil, fmt.Errorf("resolve issues: %w", err)
+	}
+	defer rows.Close()
+
+	issueIDs := make(map[issueKey]string)
+	for rows.Next() {
+		var k issueKey
+		var id string
+		if err := rows.Scan(&k.projectID, &k.fingerprint, &id); err != nil {
+			return nil, fmt.Errorf("scan issue: %w", err)
+		}
+		issueIDs[k] = id
+	}
+	return issueIDs, rows.Err()
+}
+
+// placeholders renders "($1, $2), ($3, $4)" for a multi-row statement.
+func placeholders(rows, cols int) string {
+	var b strings.Builder
+	n := 1
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := 0; c < cols; c++ {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", n)
+			n++
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
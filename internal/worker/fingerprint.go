@@ -4,12 +4,72 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/santoshkpatro/unbit/internal/models"
 )
 
-func ComputeFingerprint(properties models.Properties) string {
-	// Implement fingerprint computation logic here
+// DefaultFingerprintStrategy is the original grouping, so existing projects
+// keep their issues when upgrading.
+const DefaultFingerprintStrategy = "legacy"
+
+// exceptionTopFrames is how many of the innermost frames the "exception"
+// strategy groups on.
+const exceptionTopFrames = 5
+
+// FingerprintStrategy decides which events are grouped into the same issue.
+type FingerprintStrategy interface {
+	Name() string
+	Fingerprint(properties models.Properties) string
+}
+
+var fingerprintStrategies = map[string]FingerprintStrategy{}
+
+func registerFingerprintStrategy(s FingerprintStrategy) {
+	fingerprintStrategies[s.Name()] = s
+}
+
+func init() {
+	registerFingerprintStrategy(legacyStrategy{})
+	registerFingerprintStrategy(stackStrategy{})
+	registerFingerprintStrategy(messageStrategy{})
+	registerFingerprintStrategy(exceptionStrategy{})
+}
+
+// FingerprintStrategies lists the names projects can choose from.
+func FingerprintStrategies() []string {
+	names := make([]string, 0, len(fingerprintStrategies))
+	for name := range fingerprintStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsFingerprintStrategy reports whether name is a registered strategy.
+func IsFingerprintStrategy(name string) bool {
+	_, ok := fingerprintStrategies[name]
+	return ok
+}
+
+// strategyFingerprint groups an event with the given strategy, falling back
+// to the default one for unknown names.
+func strategyFingerprint(properties models.Properties, strategy string) string {
+	s, ok := fingerprintStrategies[strategy]
+	if !ok {
+		s = fingerprintStrategies[DefaultFingerprintStrategy]
+	}
+	return s.Fingerprint(properties)
+}
+
+// legacyStrategy hashes the raw message and every frame, line numbers included.
+type legacyStrategy struct{}
+
+func (legacyStrategy) Name() string { return "legacy" }
+
+func (legacyStrategy) Fingerprint(properties models.Properties) string {
 	data := properties.Message
 	for _, f := range properties.Stacktrace {
 		data += fmt.Sprintf("%s:%s:%d", f.Function, f.File, f.Line)
@@ -18,3 +78,168 @@ func ComputeFingerprint(properties models.Properties) string {
 
 	return hex.EncodeToString(hash[:])
 }
+
+// stackStrategy groups on the type and the function and file of in-app frames
+// of each exception in the chain, so line shifts and library upgrades don't
+// split issues.
+type stackStrategy struct{}
+
+func (stackStrategy) Name() string { return "stack" }
+
+func (s stackStrategy) Fingerprint(properties models.Properties) string {
+	parts, ok := chainParts(s.Name(), exceptionChain(properties), inAppFrames)
+	if !ok {
+		return hashParts(s.Name(), properties.Type, NormalizeMessage(properties.Message))
+	}
+	return hashParts(parts...)
+}
+
+// messageStrategy groups on the exception type and the message with variable
+// parts (ids, numbers, quoted values...) stripped.
+type messageStrategy struct{}
+
+func (messageStrategy) Name() string { return "message" }
+
+func (s messageStrategy) Fingerprint(properties models.Properties) string {
+	return hashParts(s.Name(), properties.Type, NormalizeMessage(properties.Message))
+}
+
+// exceptionStrategy groups on the type and innermost frames of each exception
+// in the chain.
+type exceptionStrategy struct{}
+
+func (exceptionStrategy) Name() string { return "exception" }
+
+func (s exceptionStrategy) Fingerprint(properties models.Properties) string {
+	parts, ok := chainParts(s.Name(), exceptionChain(properties), topFrames)
+	if !ok {
+		return hashParts(s.Name(), properties.Type, NormalizeMessage(properties.Message))
+	}
+	return hashParts(parts...)
+}
+
+// chainParts lists the type and selected frames of each exception, reporting
+// false when no exception has any frame to group on. A single exception
+// gives the same parts as before chains were supported.
+func chainParts(name string, chain []models.Exception, selectFrames func([]models.Frame) []models.Frame) ([]string, bool) {
+	parts := []string{name}
+	found := false
+	for i, exc := range chain {
+		if i > 0 {
+			parts = append(parts, "caused by")
+		}
+		parts = append(parts, exc.Type)
+		for _, f := range selectFrames(exc.Stacktrace) {
+			parts = append(parts, f.Function+"@"+f.File)
+			found = true
+		}
+	}
+	return parts, found
+}
+
+// exceptionChain returns the event's exceptions, building a single one from
+// the flat fields for events sent without a chain. When no exception carries
+// frames, the stack of the crashed or current thread stands in.
+func exceptionChain(properties models.Properties) []models.Exception {
+	chain := properties.Exceptions
+	if len(chain) == 0 {
+		chain = []models.Exception{{
+			Type:       properties.Type,
+			Value:      properties.Message,
+			Stacktrace: properties.Stacktrace,
+		}}
+	}
+	for _, exc := range chain {
+		if len(exc.Stacktrace) > 0 {
+			return chain
+		}
+	}
+
+	frames := threadFrames(properties.Threads)
+	if len(frames) == 0 {
+		return chain
+	}
+	chain = append([]models.Exception(nil), chain...)
+	chain[0].Stacktrace = frames
+	return chain
+}
+
+// threadFrames returns the stack of the crashed thread, or else the current one.
+func threadFrames(threads []models.ThreadStack) []models.Frame {
+	for _, t := range threads {
+		if t.Crashed {
+			return t.Stacktrace
+		}
+	}
+	for _, t := range threads {
+		if t.Current {
+			return t.Stacktrace
+		}
+	}
+	return nil
+}
+
+func topFrames(frames []models.Frame) []models.Frame {
+	if len(frames) > exceptionTopFrames {
+		return frames[len(frames)-exceptionTopFrames:]
+	}
+	return frames
+}
+
+var (
+	quotedPattern = regexp.MustCompile("'[^']*'|\"[^\"]*\"|`[^`]*`")
+	uuidPattern   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	hexPattern    = regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]*[0-9][0-9a-f]*[a-f][0-9a-f]*\b|\b[0-9a-f]*[a-f][0-9a-f]*[0-9][0-9a-f]*\b`)
+	numberPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+)
+
+// NormalizeMessage replaces the parts of a message that usually vary between
+// occurrences of the same error with fixed placeholders.
+func NormalizeMessage(message string) string {
+	message = quotedPattern.ReplaceAllString(message, "<str>")
+	message = uuidPattern.ReplaceAllString(message, "<uuid>")
+	message = hexPattern.ReplaceAllStringFunc(message, func(s string) string {
+		// Short mixed tokens such as "utf8" or "sha1" are words, not ids.
+		if len(s) < 8 && !strings.HasPrefix(strings.ToLower(s), "0x") {
+			return s
+		}
+		return "<hex>"
+	})
+	message = numberPattern.ReplaceAllString(message, "<num>")
+	return strings.TrimSpace(message)
+}
+
+// libraryPathMarkers identify frames that belong to dependencies or the runtime.
+var libraryPathMarkers = []string{
+	"site-packages", "dist-packages", "/lib/python", "<frozen",
+	"node_modules", "/usr/lib/", "/usr/local/lib/",
+	"/go/pkg/mod/", "/usr/local/go/src/", "/vendor/",
+}
+
+// isInApp trusts the SDK's in-app flag and otherwise guesses from the path.
+func isInApp(f models.Frame) bool {
+	if f.InApp != nil {
+		return *f.InApp
+	}
+	for _, marker := range libraryPathMarkers {
+		if strings.Contains(f.File, marker) {
+			return false
+		}
+	}
+	return true
+}
+
+func inAppFrames(frames []models.Frame) []models.Frame {
+	var out []models.Frame
+	for _, f := range frames {
+		if isInApp(f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func hashParts(parts ...string) string {
+	hash := sha1.Sum([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(hash[:])
+}
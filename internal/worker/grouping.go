@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/santoshkpatro/unbit/internal/models"
+)
+
+const (
+	maxFingerprintParts = 16
+	maxFingerprintPart  = 256
+)
+
+// Grouping is everything a project configures about how its events group.
+type Grouping struct {
+	Strategy string
+	Rules    []*GroupingRule
+	// ByEnvironment keeps events of different environments in separate issues.
+	ByEnvironment bool
+}
+
+// GroupingRule is a models.GroupingRule with its patterns compiled.
+type GroupingRule struct {
+	models.GroupingRule
+	typeRe     *regexp.Regexp
+	messageRe  *regexp.Regexp
+	fileRe     *regexp.Regexp
+	functionRe *regexp.Regexp
+}
+
+var placeholderPattern = regexp.MustCompile(`^\{\{\s*(\w+)\s*\}\}$`)
+
+// NewGroupingRule validates and compiles a grouping rule.
+func NewGroupingRule(rule models.GroupingRule) (*GroupingRule, error) {
+	if rule.TypePattern == "" && rule.MessagePattern == "" && rule.FilePattern == "" && rule.FunctionPattern == "" {
+		return nil, errors.New("at least one pattern is required")
+	}
+	if len(rule.Fingerprint) == 0 {
+		return nil, errors.New("fingerprint is required")
+	}
+	if err := ValidateFingerprint(rule.Fingerprint); err != nil {
+		return nil, err
+	}
+
+	return &GroupingRule{
+		GroupingRule: rule,
+		typeRe:       globToRegexp(rule.TypePattern),
+		messageRe:    globToRegexp(rule.MessagePattern),
+		fileRe:       globToRegexp(rule.FilePattern),
+		functionRe:   globToRegexp(rule.FunctionPattern),
+	}, nil
+}
+
+// ValidateFingerprint checks a custom fingerprint coming from an SDK or a rule.
+func ValidateFingerprint(parts []string) error {
+	if len(parts) > maxFingerprintParts {
+		return fmt.Errorf("fingerprint must have at most %d entries", maxFingerprintParts)
+	}
+	for _, p := range parts {
+		if len(p) > maxFingerprintPart {
+			return fmt.Errorf("fingerprint entries must be at most %d characters", maxFingerprintPart)
+		}
+		if m := placeholderPattern.FindStringSubmatch(p); m != nil && !isPlaceholder(m[1]) {
+			return fmt.Errorf("unknown fingerprint placeholder %q", p)
+		}
+	}
+	return nil
+}
+
+func isPlaceholder(name string) bool {
+	switch strings.ToLower(name) {
+	case "default", "type", "message":
+		return true
+	}
+	return false
+}
+
+// Matches reports whether every pattern set on the rule matches the event.
+// File and function patterns must match the same frame, in any exception of
+// the chain.
+func (r *GroupingRule) Matches(properties models.Properties) bool {
+	if r.typeRe != nil && !r.typeRe.MatchString(properties.Type) {
+		return false
+	}
+	if r.messageRe != nil && !r.messageRe.MatchString(properties.Message) {
+		return false
+	}
+	if r.fileRe == nil && r.functionRe == nil {
+		return true
+	}
+
+	for _, exc := range exceptionChain(properties) {
+		for _, f := range exc.Stacktrace {
+			if (r.fileRe == nil || r.fileRe.MatchString(f.File)) &&
+				(r.functionRe == nil || r.functionRe.MatchString(f.Function)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ComputeFingerprint applies, in order, the first matching project rule, the
+// fingerprint sent by the SDK and finally the project's strategy. Projects
+// grouping by environment mix the event's environment in, events without one
+// keep the plain fingerprint.
+func ComputeFingerprint(properties models.Properties, grouping Grouping) string {
+	fingerprint := groupFingerprint(properties, grouping)
+	if grouping.ByEnvironment && properties.Environment != "" {
+		return hashParts("environment", properties.Environment, fingerprint)
+	}
+	return fingerprint
+}
+
+func groupFingerprint(properties models.Properties, grouping Grouping) string {
+	for _, rule := range grouping.Rules {
+		if rule.Matches(properties) {
+			return customFingerprint(properties, rule.Fingerprint, grouping.Strategy)
+		}
+	}
+
+	if len(properties.Fingerprint) > 0 {
+		return customFingerprint(properties, properties.Fingerprint, grouping.Strategy)
+	}
+
+	return strategyFingerprint(properties, grouping.Strategy)
+}
+
+// customFingerprint expands the {{ default }}, {{ type }} and {{ message }}
+// placeholders and hashes the result.
+func customFingerprint(properties models.Properties, parts []string, strategy string) string {
+	expanded := make([]string, 0, len(parts)+1)
+	expanded = append(expanded, "custom")
+	for _, p := range parts {
+		m := placeholderPattern.FindStringSubmatch(p)
+		if m == nil {
+			expanded = append(expanded, p)
+			continue
+		}
+		switch strings.ToLower(m[1]) {
+		case "default":
+			expanded = append(expanded, strategyFingerprint(properties, strategy))
+		case "type":
+			expanded = append(expanded, properties.Type)
+		case "message":
+			expanded = append(expanded, NormalizeMessage(properties.Message))
+		default:
+			expanded = append(expanded, p)
+		}
+	}
+	return hashParts(expanded...)
+}
+
+// globToRegexp turns a glob where * matches any run of characters and ?
+// matches one into an anchored regexp. An empty glob matches nothing to check.
+func globToRegexp(glob string) *regexp.Regexp {
+	if glob == "" {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
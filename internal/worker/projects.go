@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/santoshkpatro/unbit/internal/models"
+)
+
+const projectCacheTTL = time.Minute
+
+// projectConfig is the per-project state the worker needs to group events.
+type projectConfig struct {
+	ID                 string `db:"id"`
+	GroupingStrategy   string `db:"grouping_strategy"`
+	GroupByEnvironment bool   `db:"group_by_environment"`
+	rules              []*GroupingRule
+}
+
+func (p projectConfig) grouping() Grouping {
+	return Grouping{Strategy: p.GroupingStrategy, Rules: p.rules, ByEnvironment: p.GroupByEnvironment}
+}
+
+type cachedProject struct {
+	config   projectConfig
+	loadedAt time.Time
+}
+
+// projectCache keeps project lookups in memory so batches don't query the
+// projects table for every event. Misses are cached too.
+type projectCache struct {
+	mu      sync.RWMutex
+	byToken map[string]cachedProject
+	byID    map[string]cachedProject
+}
+
+func newProjectCache() *projectCache {
+	return &projectCache{
+		byToken: make(map[string]cachedProject),
+		byID:    make(map[string]cachedProject),
+	}
+}
+
+// resolve returns the project owning a DSN token, or errProjectNotFound.
+func (pc *projectCache) resolve(ctx context.Context, db *sqlx.DB, token string) (projectConfig, error) {
+	return pc.load(ctx, db, pc.byToken, token, `
+		SELECT id, grouping_strategy, group_by_environment FROM projects WHERE dsn_token = $1
+	`)
+}
+
+// get returns a project by ID, or errProjectNotFound.
+func (pc *projectCache) get(ctx context.Context, db *sqlx.DB, id string) (projectConfig, error) {
+	return pc.load(ctx, db, pc.byID, id, `
+		SELECT id, grouping_strategy, group_by_environment FROM projects WHERE id = $1
+	`)
+}
+
+func (pc *projectCache) load(ctx context.Context, db *sqlx.DB, index map[string]cachedProject, key string, query string) (projectConfig, error) {
+	pc.mu.RLock()
+	cached, ok := index[key]
+	pc.mu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < projectCacheTTL {
+		if cached.config.ID == "" {
+			return projectConfig{}, errProjectNotFound
+		}
+		return cached.config, nil
+	}
+
+	var config projectConfig
+	err := db.GetContext(ctx, &config, query, key)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return projectConfig{}, err
+	}
+
+	if config.ID != "" {
+		if config.rules, err = loadGroupingRules(ctx, db, config.ID); err != nil {
+			return projectConfig{}, err
+		}
+	}
+
+	pc.mu.Lock()
+	index[key] = cachedProject{config: config, loadedAt: time.Now()}
+	pc.mu.Unlock()
+
+	if config.ID == "" {
+		return projectConfig{}, errProjectNotFound
+	}
+	return config, nil
+}
+
+func loadGroupingRules(ctx context.Context, db *sqlx.DB, projectID string) ([]*GroupingRule, error) {
+	var rows []models.GroupingRule
+	err := db.SelectContext(ctx, &rows, `
+		SELECT * FROM grouping_rules WHERE project_id = $1 ORDER BY position, created_at
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]*GroupingRule, 0, len(rows))
+	for _, row := range rows {
+		rule, err := NewGroupingRule(row)
+		if err != nil {
+			log.Printf("⚠️  skipping grouping rule %s: %v", row.ID, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
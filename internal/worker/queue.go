@@ -0,0 +1,293 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/santoshkpatro/unbit/internal/models"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+const (
+	EventStream      = "unbit:events"
+	RetrySet         = "unbit:events:retry"
+	DeadLetterStream = "unbit:events:dead"
+	ConsumerGroup    = "unbit-workers"
+
+	maxAttempts      = 5
+	baseBackoff      = 2 * time.Second
+	maxBackoff       = 5 * time.Minute
+	claimMinIdle     = 5 * time.Minute
+	readBlock        = 5 * time.Second
+	retryBatchSize   = 100
+	deadLetterMaxLen = 10000
+)
+
+// Message is a single event delivery read from the event stream.
+type Message struct {
+	ID       string
+	Payload  string
+	Attempts int
+}
+
+// DeadLetter is an event that exhausted its retries.
+type DeadLetter struct {
+	ID       string `json:"id"`
+	SourceID string `json:"sourceId"`
+	Payload  string `json:"payload"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+	FailedAt string `json:"failedAt"`
+}
+
+type retryEntry struct {
+	ID       string `json:"id"`
+	Payload  string `json:"payload"`
+	Attempts int    `json:"attempts"`
+}
+
+// promoteScript moves due retries back onto the event stream atomically, so
+// concurrent workers never promote the same entry twice.
+var promoteScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	local entry = cjson.decode(member)
+	redis.call('XADD', KEYS[2], '*', 'payload', entry.payload, 'attempts', entry.attempts)
+end
+return #due
+`)
+
+// Enqueue appends an event to the stream consumed by the workers.
+func Enqueue(ctx context.Context, cache *redis.Client, payload models.Payload) error {
+	if payload.EventID == "" {
+		payload.EventID = utils.GenerateID("evt")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return cache.XAdd(ctx, &redis.XAddArgs{
+		Stream: EventStream,
+		Values: map[string]interface{}{"payload": data, "attempts": 0},
+	}).Err()
+}
+
+func ensureGroup(ctx context.Context, cache *redis.Client) error {
+	err := cache.XGroupCreateMkStream(ctx, EventStream, ConsumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func readMessages(ctx context.Context, cache *redis.Client, consumer string, count int64) ([]Message, error) {
+	streams, err := cache.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    ConsumerGroup,
+		Consumer: consumer,
+		Streams:  []string{EventStream, ">"},
+		Count:    count,
+		Block:    readBlock,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	for _, stream := range streams {
+		for _, m := range stream.Messages {
+			messages = append(messages, toMessage(m))
+		}
+	}
+	return messages, nil
+}
+
+// claimStale takes over deliveries left unacknowledged by a worker that
+// crashed mid-event. Deliveries that keep getting stuck are dead-lettered.
+func claimStale(ctx context.Context, cache *redis.Client, consumer string, count int64) ([]Message, error) {
+	claimed, _, err := cache.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   EventStream,
+		Group:    ConsumerGroup,
+		Consumer: consumer,
+		MinIdle:  claimMinIdle,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+	for _, m := range claimed {
+		msg := toMessage(m)
+
+		pending, err := cache.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: EventStream,
+			Group:  ConsumerGroup,
+			Start:  m.ID,
+			End:    m.ID,
+			Count:  1,
+		}).Result()
+		if err == nil && len(pending) == 1 && pending[0].RetryCount > maxAttempts {
+			if err := deadLetter(ctx, cache, msg, "delivery abandoned too many times"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func toMessage(m redis.XMessage) Message {
+	payload, _ := m.Values["payload"].(string)
+	attempts, _ := strconv.Atoi(fmt.Sprint(m.Values["attempts"]))
+	return Message{ID: m.ID, Payload: payload, Attempts: attempts}
+}
+
+// ack marks deliveries as done. The entries are deleted as well so the
+// stream only ever holds outstanding events.
+func ack(ctx context.Context, cache *redis.Client, ids ...string) error {
+	pipe := cache.TxPipeline()
+	pipe.XAck(ctx, EventStream, ConsumerGroup, ids...)
+	pipe.XDel(ctx, EventStream, ids...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// retryLater schedules another attempt with exponential backoff, or
+// dead-letters the event once maxAttempts is reached.
+func retryLater(ctx context.Context, cache *redis.Client, msg Message, cause error) error {
+	attempts := msg.Attempts + 1
+	if attempts >= maxAttempts {
+		return deadLetter(ctx, cache, msg, cause.Error())
+	}
+
+	entry, err := json.Marshal(retryEntry{ID: msg.ID, Payload: msg.Payload, Attempts: attempts})
+	if err != nil {
+		return err
+	}
+
+	due := time.Now().Add(backoff(attempts))
+	pipe := cache.TxPipeline()
+	pipe.ZAdd(ctx, RetrySet, redis.Z{Score: float64(due.UnixMilli()), Member: entry})
+	pipe.XAck(ctx, EventStream, ConsumerGroup, msg.ID)
+	pipe.XDel(ctx, EventStream, msg.ID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func deadLetter(ctx context.Context, cache *redis.Client, msg Message, reason string) error {
+	pipe := cache.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: DeadLetterStream,
+		MaxLen: deadLetterMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"source_id": msg.ID,
+			"payload":   msg.Payload,
+			"attempts":  msg.Attempts + 1,
+			"error":     reason,
+			"failed_at": time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+	pipe.XAck(ctx, EventStream, ConsumerGroup, msg.ID)
+	pipe.XDel(ctx, EventStream, msg.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff << (attempts - 1)
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+// promoteRetries pushes retries whose backoff has elapsed back onto the stream.
+func promoteRetries(ctx context.Context, cache *redis.Client) (int, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	return promoteScript.Run(ctx, cache, []string{RetrySet, EventStream}, now, retryBatchSize).Int()
+}
+
+// ListDeadLetters returns up to count dead-lettered events, oldest first.
+func ListDeadLetters(ctx context.Context, cache *redis.Client, count int64) ([]DeadLetter, error) {
+	entries, err := cache.XRangeN(ctx, DeadLetterStream, "-", "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(entries))
+	for _, e := range entries {
+		attempts, _ := strconv.Atoi(fmt.Sprint(e.Values["attempts"]))
+		letters = append(letters, DeadLetter{
+			ID:       e.ID,
+			SourceID: fmt.Sprint(e.Values["source_id"]),
+			Payload:  fmt.Sprint(e.Values["payload"]),
+			Attempts: attempts,
+			Error:    fmt.Sprint(e.Values["error"]),
+			FailedAt: fmt.Sprint(e.Values["failed_at"]),
+		})
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters moves the given dead letters, or all of them when ids is
+// empty, back onto the event stream with a fresh retry budget.
+func ReplayDeadLetters(ctx context.Context, cache *redis.Client, ids []string) (int, error) {
+	var entries []redis.XMessage
+	if len(ids) == 0 {
+		all, err := cache.XRange(ctx, DeadLetterStream, "-", "+").Result()
+		if err != nil {
+			return 0, err
+		}
+		entries = all
+	} else {
+		for _, id := range ids {
+			found, err := cache.XRange(ctx, DeadLetterStream, id, id).Result()
+			if err != nil {
+				return 0, err
+			}
+			if len(found) == 0 {
+				return 0, fmt.Errorf("dead letter %s not found", id)
+			}
+			entries = append(entries, found...)
+		}
+	}
+
+	replayed := 0
+	for _, e := range entries {
+		pipe := cache.TxPipeline()
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: EventStream,
+			Values: map[string]interface{}{"payload": e.Values["payload"], "attempts": 0},
+		})
+		pipe.XDel(ctx, DeadLetterStream, e.ID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
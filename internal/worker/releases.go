@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/santoshkpatro/unbit/internal/models"
+	"github.com/santoshkpatro/unbit/internal/utils"
+)
+
+type projectValue struct {
+	projectID string
+	value     string
+}
+
+type valueCount struct {
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// countByProject counts the batch's events per project and non-empty value
+// of an event property, returning the keys in a stable order.
+func countByProject(events []*batchEvent, value func(models.Properties) string) ([]projectValue, map[projectValue]*valueCount) {
+	counts := make(map[projectValue]*valueCount)
+	for _, be := range events {
+		v := value(be.event.Properties)
+		if v == "" {
+			continue
+		}
+		key := projectValue{be.project.ID, v}
+		c := counts[key]
+		if c == nil {
+			c = &valueCount{firstSeen: be.event.Timestamp, lastSeen: be.event.Timestamp}
+			counts[key] = c
+		}
+		c.count++
+		if be.event.Timestamp.Before(c.firstSeen) {
+			c.firstSeen = be.event.Timestamp
+		}
+		if be.event.Timestamp.After(c.lastSeen) {
+			c.lastSeen = be.event.Timestamp
+		}
+	}
+
+	keys := make([]projectValue, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].projectID != keys[j].projectID {
+			return keys[i].projectID < keys[j].projectID
+		}
+		return keys[i].value < keys[j].value
+	})
+	return keys, counts
+}
+
+// countReleases records the releases the batch's events were sent from,
+// creating them on their first event.
+func countReleases(ctx context.Context, tx *sqlx.Tx, events []*batchEvent) error {
+	keys, counts := countByProject(events, func(p models.Properties) string { return p.Release })
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(keys)*6)
+	for _, k := range keys {
+		c := counts[k]
+		args = append(args, utils.GenerateID("rel"), k.projectID, k.value, c.firstSeen, c.lastSeen, c.count)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO releases (id, project_id, version, first_event_at, last_event_at, event_count)
+		VALUES `+placeholders(len(keys), 6)+`
+		ON CONFLICT (project_id, version) DO UPDATE SET
+			first_event_at = LEAST(releases.first_event_at, EXCLUDED.first_event_at),
+			last_event_at = GREATEST(releases.last_event_at, EXCLUDED.last_event_at),
+			event_count = releases.event_count + EXCLUDED.event_count,
+			updated_at = NOW()
+	`, args...); err != nil {
+		return fmt.Errorf("count releases: %w", err)
+	}
+	return nil
+}
+
+// countEnvironments records the environments each project has seen events from.
+func countEnvironments(ctx context.Context, tx *sqlx.Tx, events []*batchEvent) error {
+	keys, counts := countByProject(events, func(p models.Properties) string { return p.Environment })
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(keys)*5)
+	for _, k := range keys {
+		c := counts[k]
+		args = append(args, k.projectID, k.value, c.count, c.firstSeen, c.lastSeen)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO project_environments (project_id, name, event_count, first_seen, last_seen)
+		VALUES `+placeholders(len(keys), 5)+`
+		ON CONFLICT (project_id, name) DO UPDATE SET
+			event_count = project_environments.event_count + EXCLUDED.event_count,
+			first_seen = LEAST(project_environments.first_seen, EXCLUDED.first_seen),
+			last_seen = GREATEST(project_environments.last_seen, EXCLUDED.last_seen)
+	`, args...); err != nil {
+		return fmt.Errorf("count environments: %w", err)
+	}
+	return nil
+}
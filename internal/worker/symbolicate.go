@@ -0,0 +1,297 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/santoshkpatro/unbit/internal/models"
+	"github.com/santoshkpatro/unbit/internal/sourcemap"
+)
+
+const (
+	artifactCacheTTL  = time.Minute
+	maxCachedMaps     = 256
+	sourceContextSize = 5
+	maxSourceLineSize = 1024
+)
+
+type cachedSourceMap struct {
+	sourceMap *sourcemap.Map
+	loadedAt  time.Time
+}
+
+// artifactCache keeps the source maps resolved for a project, release and
+// file so a batch of events from the same bundle loads them once. Files
+// without a map are cached too.
+type artifactCache struct {
+	mu   sync.Mutex
+	maps map[string]cachedSourceMap
+}
+
+func newArtifactCache() *artifactCache {
+	return &artifactCache{maps: make(map[string]cachedSourceMap)}
+}
+
+func (ac *artifactCache) get(ctx context.Context, db *sqlx.DB, projectID, release, file string) *sourcemap.Map {
+	key := projectID + "\x00" + release + "\x00" + file
+
+	ac.mu.Lock()
+	cached, ok := ac.maps[key]
+	ac.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < artifactCacheTTL {
+		return cached.sourceMap
+	}
+
+	sourceMap, err := loadSourceMap(ctx, db, projectID, release, file)
+	if err != nil {
+		log.Printf("⚠️  source map for %s: %v", file, err)
+	}
+
+	ac.mu.Lock()
+	if len(ac.maps) >= maxCachedMaps {
+		for k, v := range ac.maps {
+			if time.Since(v.loadedAt) >= artifactCacheTTL {
+				delete(ac.maps, k)
+			}
+		}
+		// Maps can be large, never hold on to more than maxCachedMaps
+		for k := range ac.maps {
+			if len(ac.maps) < maxCachedMaps {
+				break
+			}
+			delete(ac.maps, k)
+		}
+	}
+	ac.maps[key] = cachedSourceMap{sourceMap: sourceMap, loadedAt: time.Now()}
+	ac.mu.Unlock()
+
+	return sourceMap
+}
+
+type artifact struct {
+	Name    string `db:"name"`
+	Content []byte `db:"content"`
+}
+
+// findArtifact returns the first of names uploaded for the release, falling
+// back to the project wide artifacts, or nil if there is none.
+func findArtifact(ctx context.Context, db *sqlx.DB, projectID, release string, names []string) (*artifact, error) {
+	var a artifact
+	err := db.GetContext(ctx, &a, `
+		SELECT name, content
+		FROM artifacts
+		WHERE project_id = $1 AND release IN ($2, '') AND name = ANY($3::text[])
+		ORDER BY release = '', array_position($3::text[], name)
+		LIMIT 1
+	`, projectID, release, pq.Array(names))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// loadSourceMap finds the map of a minified file, through the
+// sourceMappingURL comment of the uploaded file or else by its name with
+// .map appended.
+func loadSourceMap(ctx context.Context, db *sqlx.DB, projectID, release, file string) (*sourcemap.Map, error) {
+	names := artifactNames(file)
+	minified, err := findArtifact(ctx, db, projectID, release, names)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapNames []string
+	if minified != nil {
+		if ref := sourceMappingURL(minified.Content); ref != "" {
+			if strings.HasPrefix(ref, "data:") {
+				data, err := decodeDataURL(ref)
+				if err != nil {
+					return nil, err
+				}
+				return sourcemap.Parse(data)
+			}
+			mapNames = artifactNames(resolveReference(minified.Name, ref))
+		}
+	}
+	if len(mapNames) == 0 {
+		for _, name := range names {
+			mapNames = append(mapNames, name+".map")
+		}
+	}
+
+	mapped, err := findArtifact(ctx, db, projectID, release, mapNames)
+	if err != nil || mapped == nil {
+		return nil, err
+	}
+	return sourcemap.Parse(mapped.Content)
+}
+
+// artifactNames lists the names a file may have been uploaded under, best
+// match first: the URL itself, ~ followed by its path to match any host,
+// and its base name.
+func artifactNames(file string) []string {
+	names := []string{file}
+	if !strings.HasPrefix(file, "~/") {
+		if u, err := url.Parse(file); err == nil && u.Path != "" {
+			p := u.Path
+			if !strings.HasPrefix(p, "/") {
+				p = "/" + p
+			}
+			names = append(names, "~"+p)
+		}
+	}
+	if base := path.Base(stripQuery(file)); base != "." && base != "/" && base != file {
+		names = append(names, base)
+	}
+	return names
+}
+
+// resolveReference resolves a sourceMappingURL against the file it was found in.
+func resolveReference(base, ref string) string {
+	if strings.Contains(ref, "://") || strings.HasPrefix(ref, "/") {
+		return ref
+	}
+	if u, err := url.Parse(base); err == nil && u.Scheme != "" {
+		if r, err := url.Parse(ref); err == nil {
+			return u.ResolveReference(r).String()
+		}
+	}
+	return path.Join(path.Dir(base), ref)
+}
+
+// sourceMappingURL returns the target of the last //# sourceMappingURL=
+// comment of a file.
+func sourceMappingURL(content []byte) string {
+	for _, marker := range [][]byte{[]byte("//# sourceMappingURL="), []byte("//@ sourceMappingURL=")} {
+		i := bytes.LastIndex(content, marker)
+		if i < 0 {
+			continue
+		}
+		rest := content[i+len(marker):]
+		if end := bytes.IndexAny(rest, "\r\n"); end >= 0 {
+			rest = rest[:end]
+		}
+		return strings.TrimSpace(string(rest))
+	}
+	return ""
+}
+
+func decodeDataURL(ref string) ([]byte, error) {
+	meta, data, ok := strings.Cut(strings.TrimPrefix(ref, "data:"), ",")
+	if !ok {
+		return nil, errors.New("invalid inline source map")
+	}
+	if strings.HasSuffix(meta, ";base64") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	decoded, err := url.PathUnescape(data)
+	return []byte(decoded), err
+}
+
+func stripQuery(file string) string {
+	if i := strings.IndexAny(file, "?#"); i >= 0 {
+		return file[:i]
+	}
+	return file
+}
+
+// isMinifiedFrame reports whether a frame is JavaScript with a position a
+// source map can resolve.
+func isMinifiedFrame(f models.Frame) bool {
+	if f.Raw != nil || f.Line < 1 || f.Column < 1 {
+		return false
+	}
+	switch path.Ext(stripQuery(f.File)) {
+	case ".js", ".mjs", ".cjs":
+		return true
+	}
+	return false
+}
+
+// symbolicate resolves the JavaScript frames of an event through the source
+// maps uploaded for its release. Resolved frames keep the reported frame in
+// Raw; frames without a map are left alone.
+func symbolicate(ctx context.Context, db *sqlx.DB, artifacts *artifactCache, projectID string, props *models.Properties) {
+	resolve := func(frames []models.Frame) {
+		for i, f := range frames {
+			if !isMinifiedFrame(f) {
+				continue
+			}
+			sourceMap := artifacts.get(ctx, db, projectID, props.Release, f.File)
+			if sourceMap == nil {
+				continue
+			}
+			if resolved, ok := resolveFrame(sourceMap, f); ok {
+				frames[i] = resolved
+			}
+		}
+	}
+
+	resolve(props.Stacktrace)
+	for _, exc := range props.Exceptions {
+		resolve(exc.Stacktrace)
+	}
+	for _, thread := range props.Threads {
+		resolve(thread.Stacktrace)
+	}
+}
+
+func resolveFrame(sourceMap *sourcemap.Map, f models.Frame) (models.Frame, bool) {
+	pos, ok := sourceMap.Lookup(f.Line-1, f.Column-1)
+	if !ok {
+		return f, false
+	}
+
+	raw := f
+	// Locals belong to the running code, they stay on the resolved frame only
+	raw.Vars = nil
+
+	resolved := f
+	resolved.Raw = &raw
+	resolved.File = pos.Source
+	resolved.Line = pos.Line + 1
+	resolved.Column = pos.Column + 1
+	if pos.Name != "" {
+		resolved.Function = pos.Name
+	}
+
+	// The minified context says nothing about the original line
+	resolved.Code, resolved.PreContext, resolved.PostContext = "", nil, nil
+	lines := sourceMap.SourceLines(pos.Source)
+	if pos.Line >= 0 && pos.Line < len(lines) {
+		resolved.Code = truncateLine(lines[pos.Line])
+		for _, line := range lines[max(0, pos.Line-sourceContextSize):pos.Line] {
+			resolved.PreContext = append(resolved.PreContext, truncateLine(line))
+		}
+		for _, line := range lines[pos.Line+1 : min(len(lines), pos.Line+1+sourceContextSize)] {
+			resolved.PostContext = append(resolved.PostContext, truncateLine(line))
+		}
+	}
+	return resolved, true
+}
+
+func truncateLine(line string) string {
+	if len(line) <= maxSourceLineSize {
+		return line
+	}
+	cut := maxSourceLineSize
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut]
+}
@@ -0,0 +1,163 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/santoshkpatro/unbit/internal/models"
+)
+
+// MaxTagValue caps tag values, in characters. Ingest applies it to the tags
+// SDKs send and the worker to the facets derived from context blobs.
+const MaxTagValue = 200
+
+// maxRowsPerStatement keeps multi-row statements under the Postgres limit of
+// 65535 parameters. It also caps Options.BatchSize, so the per-event
+// statements of handleBatch never need chunking.
+const maxRowsPerStatement = 1000
+
+// EventTags returns the facets an event is counted under: its tags, plus
+// runtime, os and host taken from the context blobs unless tagged explicitly.
+func EventTags(properties models.Properties) map[string]string {
+	tags := make(map[string]string, len(properties.Tags)+3)
+
+	var named struct {
+		Name     string `json:"name"`
+		Version  string `json:"version"`
+		Hostname string `json:"hostname"`
+	}
+	derived := []struct {
+		key string
+		raw json.RawMessage
+	}{
+		{"runtime", properties.Runtime},
+		{"os", properties.OS},
+		{"host", properties.Host},
+	}
+	for _, d := range derived {
+		named.Name, named.Version, named.Hostname = "", "", ""
+		if len(d.raw) == 0 || json.Unmarshal(d.raw, &named) != nil {
+			continue
+		}
+		value := strings.TrimSpace(named.Name + " " + named.Version)
+		if d.key == "host" {
+			value = named.Hostname
+		}
+		if value == "" {
+			continue
+		}
+		// Counted in characters, like left() in TagValuesSQL
+		if utf8.RuneCountInString(value) > MaxTagValue {
+			value = string([]rune(value)[:MaxTagValue])
+		}
+		tags[d.key] = value
+	}
+
+	for k, v := range properties.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// TagValuesSQL aggregates the facets of the events of issues $1 the same way
+// EventTags does, for rebuilding issue_tag_values.
+var TagValuesSQL = fmt.Sprintf(`
+	SELECT issue_id, key, value, count(*) AS count, MIN(timestamp) AS first_seen, MAX(timestamp) AS last_seen
+	FROM (
+		SELECT e.issue_id, e.timestamp, t.key, t.value
+		FROM events e, jsonb_each_text(COALESCE(e.properties -> 'tags', '{}'::jsonb)) t
+		WHERE e.issue_id = ANY($1)
+		UNION ALL
+		SELECT issue_id, timestamp, 'runtime', left(trim(concat_ws(' ', properties -> 'runtime' ->> 'name', properties -> 'runtime' ->> 'version')), %[1]d)
+		FROM events
+		WHERE issue_id = ANY($1) AND properties -> 'tags' -> 'runtime' IS NULL
+		UNION ALL
+		SELECT issue_id, timestamp, 'os', left(trim(concat_ws(' ', properties -> 'os' ->> 'name', properties -> 'os' ->> 'version')), %[1]d)
+		FROM events
+		WHERE issue_id = ANY($1) AND properties -> 'tags' -> 'os' IS NULL
+		UNION ALL
+		SELECT issue_id, timestamp, 'host', left(properties -> 'host' ->> 'hostname', %[1]d)
+		FROM events
+		WHERE issue_id = ANY($1) AND properties -> 'tags' -> 'host' IS NULL
+	) t
+	WHERE value IS NOT NULL AND value <> ''
+	GROUP BY issue_id, key, value
+`, MaxTagValue)
+
+type tagValueKey struct {
+	issueID string
+	key     string
+	value   string
+}
+
+type tagValueCount struct {
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// countIssueTags adds the batch's facets to the issue_tag_values rollup.
+func countIssueTags(ctx context.Context, tx *sqlx.Tx, events []*batchEvent) error {
+	counts := make(map[tagValueKey]*tagValueCount)
+	for _, be := range events {
+		for k, v := range EventTags(be.event.Properties) {
+			key := tagValueKey{be.issueID, k, v}
+			c := counts[key]
+			if c == nil {
+				c = &tagValueCount{firstSeen: be.event.Timestamp, lastSeen: be.event.Timestamp}
+				counts[key] = c
+			}
+			c.count++
+			if be.event.Timestamp.Before(c.firstSeen) {
+				c.firstSeen = be.event.Timestamp
+			}
+			if be.event.Timestamp.After(c.lastSeen) {
+				c.lastSeen = be.event.Timestamp
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+
+	keys := make([]tagValueKey, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.issueID != b.issueID {
+			return a.issueID < b.issueID
+		}
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return a.value < b.value
+	})
+
+	for start := 0; start < len(keys); start += maxRowsPerStatement {
+		chunk := keys[start:min(start+maxRowsPerStatement, len(keys))]
+		args := make([]interface{}, 0, len(chunk)*6)
+		for _, k := range chunk {
+			c := counts[k]
+			args = append(args, k.issueID, k.key, k.value, c.count, c.firstSeen, c.lastSeen)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO issue_tag_values (issue_id, key, value, count, first_seen, last_seen)
+			VALUES `+placeholders(len(chunk), 6)+`
+			ON CONFLICT (issue_id, key, value) DO UPDATE SET
+				count = issue_tag_values.count + EXCLUDED.count,
+				first_seen = LEAST(issue_tag_values.first_seen, EXCLUDED.first_seen),
+				last_seen = GREATEST(issue_tag_values.last_seen, EXCLUDED.last_seen)
+		`, args...); err != nil {
+			return fmt.Errorf("count issue tags: %w", err)
+		}
+	}
+	return nil
+}
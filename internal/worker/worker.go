@@ -3,101 +3,200 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/redis/go-redis/v9"
 	"github.com/santoshkpatro/unbit/internal/models"
-	"github.com/santoshkpatro/unbit/internal/utils"
 )
 
-func StartWorker(cache *redis.Client, db *sqlx.DB, queue string) {
-	ctx := context.Background()
+var errProjectNotFound = errors.New("project not found")
 
-	log.Println("🚀 Worker started, listening on queue:", queue)
+// Options tunes how a worker consumes the event stream.
+type Options struct {
+	// Concurrency is the number of batches processed at once.
+	Concurrency int
+	// BatchSize is the maximum number of events written per transaction,
+	// at most maxRowsPerStatement as each event is a row of the batch inserts.
+	BatchSize int
+}
+
+// StartWorker consumes the event stream in micro-batches, with at most
+// opts.Concurrency batches in flight. Once ctx is cancelled it stops reading
+// and returns after the in-flight batches have been handled.
+func StartWorker(ctx context.Context, cache *redis.Client, db *sqlx.DB, opts Options) error {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
+	}
+	if opts.BatchSize > maxRowsPerStatement {
+		log.Printf("⚠️  batch size %d is too large, using %d", opts.BatchSize, maxRowsPerStatement)
+		opts.BatchSize = maxRowsPerStatement
+	}
+	consumer := consumerName()
+	projects := newProjectCache()
+	artifacts := newArtifactCache()
+
+	if err := ensureGroup(ctx, cache); err != nil {
+		return fmt.Errorf("creating consumer group: %w", err)
+	}
+
+	log.Printf("🚀 Worker started, consuming stream %s as %s (%d slots, batches of %d)",
+		EventStream, consumer, opts.Concurrency, opts.BatchSize)
+
+	go runRetryScheduler(ctx, cache)
 
+	// In-flight batches must still be able to commit and ack after shutdown starts.
+	workCtx := context.WithoutCancel(ctx)
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+
+	var lastClaim time.Time
 	for {
-		result, err := cache.BLPop(ctx, 0, queue).Result()
-		if err != nil {
-			log.Println("❌ Error fetching job from queue:", err)
-			continue
+		// Take a slot before reading so we never hold deliveries we can't start.
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			log.Println("✅ Worker drained, exiting")
+			return nil
+		case sem <- struct{}{}:
 		}
 
-		payloadJSON := result[1]
-		var payload models.Payload
-		if err := json.Unmarshal([]byte(payloadJSON), &payload); err != nil {
-			log.Println("❌ Error unmarshaling event:", err)
+		var messages []Message
+		batchSize := int64(opts.BatchSize)
+
+		if time.Since(lastClaim) > claimMinIdle/2 {
+			stale, err := claimStale(ctx, cache, consumer, batchSize)
+			if err != nil && ctx.Err() == nil {
+				log.Println("❌ Error claiming stale events:", err)
+			}
+			messages = append(messages, stale...)
+			lastClaim = time.Now()
+		}
+
+		if remaining := batchSize - int64(len(messages)); remaining > 0 {
+			fresh, err := readMessages(ctx, cache, consumer, remaining)
+			if err != nil && ctx.Err() == nil {
+				log.Println("❌ Error fetching job from queue:", err)
+				time.Sleep(time.Second)
+			}
+			messages = append(messages, fresh...)
+		}
+
+		if len(messages) == 0 {
+			<-sem
 			continue
 		}
 
-		go handleEvent(db, payload.DSNToken, payload.Event)
+		wg.Add(1)
+		go func(messages []Message) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			processBatch(workCtx, cache, db, projects, artifacts, messages)
+		}(messages)
 	}
 }
 
-func handleEvent(db *sqlx.DB, dsnToken string, event models.Event) {
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Println("begin tx:", err)
-		return
+func runRetryScheduler(ctx context.Context, cache *redis.Client) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := promoteRetries(ctx, cache); err != nil {
+				log.Println("❌ Error promoting retries:", err)
+			}
+		}
 	}
-	defer tx.Rollback() // no-op if Commit succeeds
+}
 
-	fingerprint := ComputeFingerprint(event.Properties)
+// processBatch only acknowledges deliveries once their transaction has been
+// committed. If a batch fails, its events are retried one by one so a single
+// bad event can't hold back the rest; failing events are then retried later
+// or dead-lettered.
+func processBatch(ctx context.Context, cache *redis.Client, db *sqlx.DB, projects *projectCache, artifacts *artifactCache, messages []Message) {
+	events := make([]*batchEvent, 0, len(messages))
+	for _, msg := range messages {
+		var payload models.Payload
+		if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+			log.Println("❌ Error unmarshaling event:", err)
+			if err := deadLetter(ctx, cache, msg, fmt.Sprintf("invalid payload: %v", err)); err != nil {
+				log.Println("❌ dead-letter:", err)
+			}
+			continue
+		}
 
-	var projectId string
-	if err = tx.Get(&projectId, `SELECT id FROM projects WHERE dsn_token = $1`, dsnToken); err != nil {
-		log.Println("❌ project lookup:", err)
-		return
-	}
+		var project projectConfig
+		var err error
+		if payload.ProjectID != "" {
+			project, err = projects.get(ctx, db, payload.ProjectID)
+		} else {
+			project, err = projects.resolve(ctx, db, payload.DSNToken)
+		}
+		if err != nil {
+			failMessage(ctx, cache, msg, err)
+			continue
+		}
 
-	// unique index on (project_id, fingerprint) recommended
-	var issueId string
-	newIssueId := utils.GenerateID("isu")
-	if err = tx.Get(&issueId, `
-		INSERT INTO issues (id, project_id, fingerprint, status, event_count)
-		VALUES ($1, $2, $3, 'unresolved', 0)
-		ON CONFLICT (project_id, fingerprint)
-		DO UPDATE SET updated_at = NOW()
-		RETURNING id
-	`, newIssueId, projectId, fingerprint); err != nil {
-		log.Println("❌ upsert issue:", err)
-		return
-	}
+		// Resolve minified frames before they are fingerprinted
+		symbolicate(ctx, db, artifacts, project.ID, &payload.Event.Properties)
 
-	eventId := utils.GenerateID("evt")
-	if _, err = tx.Exec(`
-		INSERT INTO events (id, issue_id, timestamp, properties, project_id, event_type)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, eventId, issueId, event.Timestamp, PropertiesToJSON(event.Properties), projectId, `issues`); err != nil {
-		log.Println("❌ insert event:", err)
+		// Payloads queued before events had ids fall back to the delivery's
+		// id, which stays the same when a stale delivery is claimed again
+		id := payload.EventID
+		if id == "" {
+			id = "evt_" + msg.ID
+		}
+		events = append(events, &batchEvent{msg: msg, id: id, project: project, event: payload.Event})
+	}
+	if len(events) == 0 {
 		return
 	}
 
-	if _, err = tx.Exec(`
-		UPDATE issues
-		SET event_count = event_count + 1, updated_at = NOW()
-		WHERE id = $1
-	`, issueId); err != nil {
-		log.Println("❌ bump count:", err)
+	err := handleBatch(ctx, db, events)
+	if err == nil {
+		ids := make([]string, len(events))
+		for i, be := range events {
+			ids[i] = be.msg.ID
+		}
+		if err := ack(ctx, cache, ids...); err != nil {
+			log.Println("❌ ack:", err)
+		}
+		log.Printf("Processed %d event(s)", len(events))
 		return
 	}
 
-	if _, err = tx.Exec(`
-		UPDATE projects
-		SET total_events = total_events + 1
-		WHERE id = $1
-	`, projectId); err != nil {
-		log.Println("❌ bump project event count:", err)
+	if len(events) == 1 {
+		failMessage(ctx, cache, events[0].msg, err)
 		return
 	}
 
-	if err = tx.Commit(); err != nil {
-		log.Println("❌ commit:", err)
-		return
+	log.Printf("❌ batch of %d failed, retrying individually: %v", len(events), err)
+	for _, be := range events {
+		processBatch(ctx, cache, db, projects, artifacts, []Message{be.msg})
 	}
+}
 
-	fmt.Printf("Processing event for project %s, issue %s\n", projectId, eventId)
+func failMessage(ctx context.Context, cache *redis.Client, msg Message, cause error) {
+	var err error
+	if errors.Is(cause, errProjectNotFound) {
+		err = deadLetter(ctx, cache, msg, cause.Error())
+	} else {
+		log.Printf("❌ event %s failed (attempt %d): %v", msg.ID, msg.Attempts+1, cause)
+		err = retryLater(ctx, cache, msg, cause)
+	}
+	if err != nil {
+		log.Println("❌ reschedule event:", err)
+	}
 }
 
 func PropertiesToJSON(props models.Properties) string {